@@ -1,29 +1,118 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"webk8s/internal/api"
+	"webk8s/internal/audit"
+	"webk8s/internal/k8s"
+	"webk8s/internal/metrics"
 	"webk8s/internal/web"
 )
 
 func main() {
+	var cfgOpts k8s.ConfigOptions
+	var apiOpts api.Options
+	var revealNamespaces, auditLog string
+	var metricsInterval, metricsRetention time.Duration
+	var promCfg k8s.PrometheusConfig
+	var promTokenFile, promPasswordFile string
+	flag.StringVar(&cfgOpts.Kubeconfig, "kubeconfig", "", "path to a kubeconfig file (defaults to in-cluster config, then $KUBECONFIG or ~/.kube/config)")
+	flag.StringVar(&cfgOpts.Context, "context", "", "kubeconfig context to use as the default cluster")
+	flag.StringVar(&cfgOpts.ClustersFile, "clusters-config", "", "path to a YAML/JSON file listing the clusters to serve (overrides --kubeconfig/--context)")
+	flag.DurationVar(&apiOpts.APITimeout, "api-timeout", 30*time.Second, "deadline for each request's Kubernetes API calls (0 disables)")
+	flag.BoolVar(&apiOpts.ReadOnly, "read-only", false, "disable all actions that modify the cluster (scale, restart, rollback, cordon, drain)")
+	flag.BoolVar(&apiOpts.TrustForwardedUser, "trust-forwarded-user", false, "audit the user named by X-Forwarded-User and similar headers (only behind an authenticating proxy that sets them)")
+	flag.Int64Var(&apiOpts.LogArchiveMaxBytes, "log-archive-max-bytes", 100<<20, "maximum log bytes in one log download archive (0 for no limit)")
+	flag.DurationVar(&metricsInterval, "metrics-interval", 30*time.Second, "how often pod and node metrics are sampled for /api/metrics/history (0 disables)")
+	flag.DurationVar(&metricsRetention, "metrics-retention", time.Hour, "how much metrics history is kept in memory")
+	flag.StringVar(&promCfg.URL, "prometheus-url", "", "Prometheus server to read pod/node/workload usage and history from instead of metrics-server")
+	flag.StringVar(&promTokenFile, "prometheus-bearer-token-file", "", "file holding a bearer token for Prometheus")
+	flag.StringVar(&promCfg.Username, "prometheus-username", "", "basic auth user for Prometheus (password from --prometheus-password-file)")
+	flag.StringVar(&promPasswordFile, "prometheus-password-file", "", "file holding the Prometheus basic auth password")
+	flag.StringVar(&promCfg.ClusterLabel, "prometheus-cluster-label", "", "label that identifies the cluster in a Prometheus shared by several clusters (e.g. cluster); without it only the default cluster reads Prometheus")
+	flag.StringVar(&promCfg.NodeLabel, "prometheus-node-label", k8s.DefaultPrometheusNodeLabel, "label holding the node name of the cAdvisor series (e.g. instance or kubernetes_io_hostname)")
+	flag.StringVar(&promCfg.CPUQuery, "prometheus-cpu-query", k8s.DefaultPrometheusCPUQuery, "PromQL template for CPU usage in cores")
+	flag.StringVar(&promCfg.MemoryQuery, "prometheus-memory-query", k8s.DefaultPrometheusMemoryQuery, "PromQL template for memory usage in bytes")
+	flag.BoolVar(&apiOpts.SecretReveal, "secret-reveal", false, "allow revealing secret values through the API")
+	flag.StringVar(&revealNamespaces, "secret-reveal-namespaces", "", "comma-separated namespaces whose secret values may be revealed (\"*\" for all)")
+	flag.StringVar(&auditLog, "audit-log", "", "file to append audit records to (defaults to stderr)")
+	flag.Parse()
+
+	for _, ns := range strings.Split(revealNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			apiOpts.SecretRevealNamespaces = append(apiOpts.SecretRevealNamespaces, ns)
+		}
+	}
+
+	if err := audit.Open(auditLog); err != nil {
+		log.Fatal(err)
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	if err := k8s.Init(cfgOpts); err != nil {
+		log.Fatalf("failed to load clusters: %v", err)
+	}
+
+	for _, cl := range k8s.Clusters() {
+		if cl.Err != nil {
+			log.Printf("cluster %s unavailable: %v", cl.Name, cl.Err)
+			continue
+		}
+		log.Printf("cluster %s -> %s", cl.Name, cl.Server)
+	}
+
+	if promCfg.URL != "" {
+		var err error
+		if promCfg.BearerToken, err = readSecretFile(promTokenFile); err != nil {
+			log.Fatal(err)
+		}
+		if promCfg.Password, err = readSecretFile(promPasswordFile); err != nil {
+			log.Fatal(err)
+		}
+		provider, err := k8s.NewPrometheusProvider(promCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Without a cluster label the server is assumed to hold only the
+		// default cluster's metrics; the others keep using metrics-server.
+		promClusters := []string{k8s.DefaultCluster()}
+		if promCfg.ClusterLabel != "" {
+			promClusters = nil
+			for _, cl := range k8s.Clusters() {
+				promClusters = append(promClusters, cl.Name)
+			}
+		}
+		for _, name := range promClusters {
+			k8s.SetMetricsProvider(name, provider)
+		}
+		log.Printf("reading metrics of %s from Prometheus at %s", strings.Join(promClusters, ", "), promCfg.URL)
+	}
+	if metricsInterval > 0 {
+		// Clusters read from Prometheus keep their own history and are skipped.
+		k8s.StartMetricsHistory(context.Background(), metricsInterval, metricsRetention)
+	}
+
 	r := gin.New()
-	r.Use(gin.Logger(), gin.Recovery())
+	r.Use(gin.Logger(), metrics.Middleware(), gin.Recovery())
 
 	// Serve UI + assets
 	web.RegisterStatic(r)
 
 	// API
-	api.RegisterRoutes(r)
+	api.RegisterRoutes(r, apiOpts)
 
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -35,3 +124,16 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// readSecretFile returns the trimmed contents of path, or "" when path is
+// empty.
+func readSecretFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"webk8s/internal/audit"
+	"webk8s/internal/k8s"
+)
+
+// ScaleWorkload sets the replicas of a deployment, statefulset or replicaset.
+func ScaleWorkload(c *gin.Context) {
+	ns := c.Query("namespace")
+	kind := c.Query("type")
+	name := c.Query("name")
+
+	if ns == "" || kind == "" || name == "" || c.Query("replicas") == "" {
+		badRequest(c, "namespace, type, name and replicas parameters are required")
+		return
+	}
+	if !oneOf(kind, k8s.ScalableKinds) {
+		badRequest(c, "type must be one of deployments, statefulsets, replicasets")
+		return
+	}
+	replicas, err := strconv.ParseInt(c.Query("replicas"), 10, 32)
+	if err != nil || replicas < 0 {
+		badRequest(c, "replicas must be a non-negative integer")
+		return
+	}
+	dryRun := c.Query("dryRun") == "true"
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	rec := actionRecord(c, cl, "workload.scale", ns, kind, name, dryRun)
+	rec.Detail["replicas"] = replicas
+	if !mutationAllowed(c, rec) {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	res, err := k8s.ScaleWorkload(ctx, cl, kind, ns, name, int32(replicas), dryRun)
+	if err != nil {
+		actionFailed(c, rec, err)
+		return
+	}
+
+	rec.Outcome = audit.OutcomeSuccess
+	rec.Detail["from"] = res.From
+	audit.Log(rec)
+	c.JSON(200, res)
+}
+
+// RestartWorkload triggers a rollout restart of a deployment, statefulset or
+// daemonset.
+func RestartWorkload(c *gin.Context) {
+	ns := c.Query("namespace")
+	kind := c.Query("type")
+	name := c.Query("name")
+
+	if ns == "" || kind == "" || name == "" {
+		badRequest(c, "namespace, type and name parameters are required")
+		return
+	}
+	if !oneOf(kind, k8s.RestartableKinds) {
+		badRequest(c, "type must be one of deployments, statefulsets, daemonsets")
+		return
+	}
+	dryRun := c.Query("dryRun") == "true"
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	rec := actionRecord(c, cl, "workload.restart", ns, kind, name, dryRun)
+	if !mutationAllowed(c, rec) {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	res, err := k8s.RestartWorkload(ctx, cl, kind, ns, name, dryRun)
+	if err != nil {
+		actionFailed(c, rec, err)
+		return
+	}
+
+	rec.Outcome = audit.OutcomeSuccess
+	rec.Detail["restartedAt"] = res.RestartedAt
+	audit.Log(rec)
+	c.JSON(200, res)
+}
+
+// RollbackDeployment rolls a deployment back to a ReplicaSet revision, or to
+// the previous one when no revision is given.
+func RollbackDeployment(c *gin.Context) {
+	ns := c.Query("namespace")
+	name := c.Query("deployment")
+
+	if ns == "" || name == "" {
+		badRequest(c, "namespace and deployment parameters are required")
+		return
+	}
+	revision, err := revisionParam(c, "revision")
+	if err != nil {
+		badRequest(c, "revision must be a revision number")
+		return
+	}
+	dryRun := c.Query("dryRun") == "true"
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	rec := actionRecord(c, cl, "deployment.rollback", ns, "deployments", name, dryRun)
+	rec.Detail["revision"] = revision
+	if !mutationAllowed(c, rec) {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	res, err := k8s.RollbackDeployment(ctx, cl, ns, name, revision, dryRun)
+	if err != nil {
+		actionFailed(c, rec, err)
+		return
+	}
+
+	rec.Outcome = audit.OutcomeSuccess
+	rec.Detail["fromRevision"] = res.FromRevision
+	rec.Detail["toRevision"] = res.ToRevision
+	rec.Detail["skipped"] = res.Skipped
+	audit.Log(rec)
+	c.JSON(200, res)
+}
+
+// actionRecord starts the audit record of a mutating action.
+func actionRecord(c *gin.Context, cl *k8s.Cluster, action, ns, resource, name string, dryRun bool) audit.Record {
+	rec := auditRecord(c, cl, action)
+	rec.Namespace = ns
+	rec.Resource = resource
+	rec.Name = name
+	rec.Detail = map[string]any{"dryRun": dryRun}
+	return rec
+}
+
+// mutationAllowed rejects the request with 403 when the server runs with
+// --read-only, recording the denied attempt.
+func mutationAllowed(c *gin.Context, rec audit.Record) bool {
+	if !options.ReadOnly {
+		return true
+	}
+	rec.Outcome = audit.OutcomeDenied
+	audit.Log(rec)
+	respondError(c, APIError{
+		Code:    http.StatusForbidden,
+		Reason:  "ReadOnly",
+		Message: "webk8s is running in read-only mode",
+	})
+	return false
+}
+
+func actionFailed(c *gin.Context, rec audit.Record, err error) {
+	rec.Outcome = audit.OutcomeFailed
+	rec.Error = err.Error()
+	audit.Log(rec)
+	log.Printf("Error running %s (ns=%s, %s=%s): %v", rec.Action, rec.Namespace, rec.Resource, rec.Name, err)
+	respondError(c, err)
+}
+
+func oneOf(v string, allowed []string) bool {
+	for _, a := range allowed {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"webk8s/internal/audit"
+	"webk8s/internal/k8s"
+)
+
+// requestUser identifies the caller from the headers set by an
+// authenticating proxy (oauth2-proxy, ingress auth). webk8s has no login of
+// its own and any client can send these headers, so they are only trusted
+// with --trust-forwarded-user; otherwise every caller is anonymous.
+func requestUser(c *gin.Context) string {
+	if !options.TrustForwardedUser {
+		return "anonymous"
+	}
+	for _, h := range []string{"X-Forwarded-User", "X-Forwarded-Email", "X-Remote-User", "X-Auth-Request-User"} {
+		if v := c.GetHeader(h); v != "" {
+			return v
+		}
+	}
+	return "anonymous"
+}
+
+// auditRecord starts an audit record for an action against cl.
+func auditRecord(c *gin.Context, cl *k8s.Cluster, action string) audit.Record {
+	return audit.Record{
+		User:     requestUser(c),
+		SourceIP: c.ClientIP(),
+		Action:   action,
+		Cluster:  cl.Name,
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxJSONBody caps the body of the mutating endpoints, which only carry a
+// handful of parameters.
+const maxJSONBody = 64 << 10
+
+// requireJSON guards the mutating (POST) routes against cross-site requests.
+// A browser only sends a cross-origin application/json POST after a CORS
+// preflight, which webk8s never answers, so a plain form or image request
+// from another site is rejected here. The body must be a JSON object; its
+// fields are merged into the query string, so parameters may be sent either
+// way and handlers keep reading them with c.Query.
+func requireJSON(c *gin.Context) {
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		respondError(c, APIError{
+			Code:    http.StatusUnsupportedMediaType,
+			Reason:  "UnsupportedMediaType",
+			Message: "this endpoint requires a JSON body with Content-Type: application/json",
+		})
+		c.Abort()
+		return
+	}
+
+	var body map[string]any
+	dec := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxJSONBody))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil || body == nil {
+		badRequest(c, "request body must be a JSON object")
+		c.Abort()
+		return
+	}
+
+	q := c.Request.URL.Query()
+	for k, v := range body {
+		switch v := v.(type) {
+		case string:
+			q.Set(k, v)
+		case json.Number, bool:
+			q.Set(k, fmt.Sprint(v))
+		default:
+			badRequest(c, fmt.Sprintf("parameter %s must be a string, number or boolean", k))
+			c.Abort()
+			return
+		}
+	}
+	c.Request.URL.RawQuery = q.Encode()
+}
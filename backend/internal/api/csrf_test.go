@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/action", requireJSON, func(c *gin.Context) {
+		c.String(200, "%s %s %s", c.Query("name"), c.Query("replicas"), c.Query("dryRun"))
+	})
+
+	tests := []struct {
+		name        string
+		contentType string
+		url         string
+		body        string
+		code        int
+		want        string
+	}{
+		{"form post", "application/x-www-form-urlencoded", "/action?name=a&replicas=0", "x=1", http.StatusUnsupportedMediaType, ""},
+		{"text plain", "text/plain", "/action?name=a", "{}", http.StatusUnsupportedMediaType, ""},
+		{"no content type", "", "/action?name=a", "{}", http.StatusUnsupportedMediaType, ""},
+		{"empty body", "application/json", "/action?name=a", "", http.StatusBadRequest, ""},
+		{"array body", "application/json", "/action?name=a", "[]", http.StatusBadRequest, ""},
+		{"nested value", "application/json", "/action", `{"name":{"a":1}}`, http.StatusBadRequest, ""},
+		{"query params", "application/json", "/action?name=a&replicas=2", "{}", 200, "a 2 "},
+		{"body params", "application/json; charset=utf-8", "/action", `{"name":"b","replicas":3,"dryRun":true}`, 200, "b 3 true"},
+		{"body overrides query", "application/json", "/action?name=a&replicas=1", `{"replicas":0}`, 200, "a 0 "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("code = %d, want %d (%s)", w.Code, tt.code, w.Body)
+			}
+			if tt.code == 200 && w.Body.String() != tt.want {
+				t.Errorf("params = %q, want %q", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestUserTrust(t *testing.T) {
+	defer func(o Options) { options = o }(options)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Request.Header.Set("X-Forwarded-User", "mallory")
+
+	options.TrustForwardedUser = false
+	if got := requestUser(c); got != "anonymous" {
+		t.Errorf("untrusted requestUser = %q, want anonymous", got)
+	}
+	options.TrustForwardedUser = true
+	if got := requestUser(c); got != "mallory" {
+		t.Errorf("trusted requestUser = %q, want mallory", got)
+	}
+}
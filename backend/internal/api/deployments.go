@@ -0,0 +1,87 @@
+package api
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"webk8s/internal/k8s"
+)
+
+// GetDeploymentDetails returns a deployment's spec summary, owned
+// ReplicaSets and rollout status.
+func GetDeploymentDetails(c *gin.Context) {
+	ns := c.Query("namespace")
+	name := c.Query("deployment")
+
+	if ns == "" || name == "" {
+		badRequest(c, "namespace and deployment parameters are required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	details, err := k8s.GetDeploymentDetails(ctx, cl, ns, name)
+	if err != nil {
+		log.Printf("Error getting deployment details (ns=%s, deployment=%s): %v", ns, name, err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(200, details)
+}
+
+// GetDeploymentDiff diffs the pod templates of two deployment revisions.
+// "to" defaults to the current revision and "from" to the one before it.
+func GetDeploymentDiff(c *gin.Context) {
+	ns := c.Query("namespace")
+	name := c.Query("deployment")
+
+	if ns == "" || name == "" {
+		badRequest(c, "namespace and deployment parameters are required")
+		return
+	}
+
+	from, err := revisionParam(c, "from")
+	if err != nil {
+		badRequest(c, "from must be a revision number")
+		return
+	}
+	to, err := revisionParam(c, "to")
+	if err != nil {
+		badRequest(c, "to must be a revision number")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	diff, err := k8s.DiffDeploymentRevisions(ctx, cl, ns, name, from, to)
+	if err != nil {
+		log.Printf("Error diffing deployment revisions (ns=%s, deployment=%s): %v", ns, name, err)
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(200, diff)
+}
+
+func revisionParam(c *gin.Context, key string) (int64, error) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
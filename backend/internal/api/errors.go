@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"webk8s/internal/k8s"
+)
+
+// APIError is the body of every error response, and the data of SSE
+// "error" events.
+type APIError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+func (e APIError) Error() string { return e.Message }
+
+// Reasons for errors that don't come from the Kubernetes API.
+const (
+	reasonClusterNotFound    = "ClusterNotFound"
+	reasonClusterUnavailable = "ClusterUnavailable"
+	reasonAPIUnreachable     = "APIServerUnreachable"
+	reasonCanceled           = "Canceled"
+	reasonInternal           = "InternalError"
+)
+
+// translateError maps client-go and webk8s errors to an HTTP status and a
+// machine-readable reason.
+func translateError(err error) APIError {
+	var apiErr APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	out := APIError{Code: http.StatusInternalServerError, Reason: reasonInternal, Message: err.Error()}
+
+	switch {
+	case errors.Is(err, k8s.ErrUnknownCluster):
+		out.Code, out.Reason = http.StatusNotFound, reasonClusterNotFound
+	case errors.Is(err, k8s.ErrClusterUnavailable):
+		out.Code, out.Reason = http.StatusServiceUnavailable, reasonClusterUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		out.Code, out.Reason = http.StatusGatewayTimeout, string(metav1.StatusReasonTimeout)
+	case errors.Is(err, context.Canceled):
+		out.Code, out.Reason = 499, reasonCanceled
+	case apierrors.IsNotFound(err):
+		out.Code, out.Reason = http.StatusNotFound, string(metav1.StatusReasonNotFound)
+	case apierrors.IsForbidden(err):
+		out.Code, out.Reason = http.StatusForbidden, string(metav1.StatusReasonForbidden)
+	case apierrors.IsUnauthorized(err):
+		out.Code, out.Reason = http.StatusUnauthorized, string(metav1.StatusReasonUnauthorized)
+	case apierrors.IsConflict(err):
+		out.Code, out.Reason = http.StatusConflict, string(metav1.StatusReasonConflict)
+	case apierrors.IsAlreadyExists(err):
+		out.Code, out.Reason = http.StatusConflict, string(metav1.StatusReasonAlreadyExists)
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err):
+		out.Code, out.Reason = http.StatusGatewayTimeout, string(metav1.StatusReasonTimeout)
+	case apierrors.IsTooManyRequests(err):
+		out.Code, out.Reason = http.StatusTooManyRequests, string(metav1.StatusReasonTooManyRequests)
+	case apierrors.IsInvalid(err):
+		out.Code, out.Reason = http.StatusUnprocessableEntity, string(metav1.StatusReasonInvalid)
+	case apierrors.IsBadRequest(err):
+		out.Code, out.Reason = http.StatusBadRequest, string(metav1.StatusReasonBadRequest)
+	case apierrors.IsResourceExpired(err), apierrors.IsGone(err):
+		out.Code, out.Reason = http.StatusGone, string(metav1.StatusReasonExpired)
+	case apierrors.IsServiceUnavailable(err):
+		out.Code, out.Reason = http.StatusServiceUnavailable, string(metav1.StatusReasonServiceUnavailable)
+	case isNetError(err):
+		out.Code, out.Reason = http.StatusBadGateway, reasonAPIUnreachable
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		if d := status.Status().Details; d != nil {
+			out.Details = d
+		}
+	}
+	return out
+}
+
+func isNetError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// respondError writes err as a structured JSON error response.
+func respondError(c *gin.Context, err error) {
+	e := translateError(err)
+	c.JSON(e.Code, e)
+}
+
+// badRequest writes a 400 for invalid or missing request parameters.
+func badRequest(c *gin.Context, message string) {
+	respondError(c, APIError{Code: http.StatusBadRequest, Reason: string(metav1.StatusReasonBadRequest), Message: message})
+}
+
+// sseError sends err as an SSE "error" event.
+func sseError(c *gin.Context, err error) {
+	c.SSEvent("error", translateError(err))
+	c.Writer.Flush()
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+
+	"webk8s/internal/k8s"
+)
+
+// Limits of /api/events.
+const (
+	defaultEventLimit = 500
+	maxEventLimit     = 5000
+)
+
+// ListEvents returns the events of a namespace (all namespaces when empty),
+// newest first with repeats folded together. Filters:
+//
+//	kind, name, uid     the involved object (kind is case-insensitive)
+//	type                Normal or Warning
+//	reason              event reason, e.g. BackOff
+//	since=1h            only events seen in the last duration
+//	sinceTime=RFC3339   only events seen after this time
+//	limit=N             at most N events (default 500)
+//
+// On very busy clusters only the newest 20000 matching events are considered,
+// and the response carries an X-Events-Truncated: true header.
+func ListEvents(c *gin.Context) {
+	q := k8s.EventQuery{
+		Namespace: c.Query("namespace"),
+		Kind:      c.Query("kind"),
+		Name:      c.Query("name"),
+		UID:       c.Query("uid"),
+		Reason:    c.Query("reason"),
+		Limit:     defaultEventLimit,
+	}
+
+	switch t := c.Query("type"); {
+	case t == "":
+	case strings.EqualFold(t, v1.EventTypeNormal):
+		q.Type = v1.EventTypeNormal
+	case strings.EqualFold(t, v1.EventTypeWarning):
+		q.Type = v1.EventTypeWarning
+	default:
+		badRequest(c, "type must be Normal or Warning")
+		return
+	}
+
+	since, sinceTime := c.Query("since"), c.Query("sinceTime")
+	if since != "" && sinceTime != "" {
+		badRequest(c, "only one of since and sinceTime may be set")
+		return
+	}
+	if since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			badRequest(c, "since must be a positive duration like 30m or 24h")
+			return
+		}
+		q.Since = time.Now().Add(-d)
+	}
+	if sinceTime != "" {
+		t, err := time.Parse(time.RFC3339, sinceTime)
+		if err != nil {
+			badRequest(c, "sinceTime must be an RFC3339 time")
+			return
+		}
+		q.Since = t
+	}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEventLimit {
+			badRequest(c, "limit must be between 1 and "+strconv.Itoa(maxEventLimit))
+			return
+		}
+		q.Limit = n
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	events, truncated, err := k8s.ListEvents(ctx, cl, q)
+	if err != nil {
+		log.Printf("Error listing events (ns=%s, kind=%s, name=%s): %v", q.Namespace, q.Kind, q.Name, err)
+		respondError(c, err)
+		return
+	}
+	if truncated {
+		c.Header("X-Events-Truncated", "true")
+	}
+	c.JSON(200, events)
+}
@@ -5,15 +5,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"webk8s/internal/k8s"
+	"webk8s/internal/metrics"
 )
 
+// clusterHealthTimeout bounds the per-cluster probes behind /api/clusters.
+const clusterHealthTimeout = 5 * time.Second
+
+// sseHeartbeatInterval is how often idle SSE streams send a comment line to
+// keep proxies from closing the connection.
+const sseHeartbeatInterval = 15 * time.Second
+
 var resourceTypes = []map[string]string{
 	{"key": "pods", "label": "Pods"},
 	{"key": "nodes", "label": "Nodes"},
@@ -24,23 +36,106 @@ var resourceTypes = []map[string]string{
 	{"key": "jobs", "label": "Jobs"},
 	{"key": "cronjobs", "label": "CronJobs"},
 	{"key": "configmaps", "label": "ConfigMaps"},
+	{"key": "secrets", "label": "Secrets"},
 	{"key": "services", "label": "Services"},
 }
 
+// requestContext returns the context for the Kubernetes calls a request
+// makes: it is cancelled when the client disconnects and bounded by the
+// configured --api-timeout. Streaming endpoints use c.Request.Context()
+// directly instead, since they are meant to outlive any fixed deadline.
+func requestContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	if options.APITimeout <= 0 {
+		return context.WithCancel(c.Request.Context())
+	}
+	return context.WithTimeout(c.Request.Context(), options.APITimeout)
+}
+
+// clusterFor resolves the optional ?cluster= parameter (empty selects the
+// default cluster) and writes an error response when it can't be used.
+func clusterFor(c *gin.Context) (*k8s.Cluster, bool) {
+	name := c.Query("cluster")
+	cl, err := k8s.GetCluster(name)
+	if err != nil {
+		e := translateError(err)
+		e.Details = gin.H{"cluster": name}
+		respondError(c, e)
+		return nil, false
+	}
+	return cl, true
+}
+
+// GetClusters lists the configured clusters with a live health check for each.
+func GetClusters(c *gin.Context) {
+	clusters := k8s.Clusters()
+	def := k8s.DefaultCluster()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), clusterHealthTimeout)
+	defer cancel()
+
+	out := make([]k8s.ClusterHealth, len(clusters))
+	var wg sync.WaitGroup
+	for i, cl := range clusters {
+		wg.Add(1)
+		go func(i int, cl *k8s.Cluster) {
+			defer wg.Done()
+			out[i] = cl.Health(ctx)
+			out[i].Default = cl.Name == def
+		}(i, cl)
+	}
+	wg.Wait()
+
+	c.JSON(200, out)
+}
+
+// GetResourceTypes returns every listable API type the cluster serves
+// (including CRDs), sorted by API group. Built-in types keep the labels
+// above; if discovery fails only those are returned.
 func GetResourceTypes(c *gin.Context) {
-	c.JSON(200, resourceTypes)
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	types, err := k8s.ListResourceTypes(ctx, cl)
+	if err != nil {
+		log.Printf("Error discovering resource types: %v", err)
+		c.JSON(200, resourceTypes)
+		return
+	}
+
+	labels := map[string]string{}
+	for _, t := range resourceTypes {
+		labels[t["key"]] = t["label"]
+	}
+
+	out := make([]k8s.APIResourceType, 0, len(types))
+	for _, t := range types {
+		if label, ok := labels[t.Key]; ok {
+			t.Label = label
+		}
+		out = append(out, t)
+	}
+	c.JSON(200, out)
 }
 
 func GetNamespaces(c *gin.Context) {
-	client := k8s.Clientset()
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+	client := cl.Clientset
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := requestContext(c)
 	defer cancel()
 
 	list, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		log.Printf("Error listing namespaces: %v", err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -57,38 +152,168 @@ func ListResources(c *gin.Context) {
 	ns := c.Query("namespace")
 	rtype := c.Query("type")
 
-	if ns == "" && rtype != "nodes" {
-		c.JSON(400, gin.H{"error": "namespace parameter is required"})
+	if rtype == "" {
+		badRequest(c, "type parameter is required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
 		return
 	}
-	if rtype == "" {
-		c.JSON(400, gin.H{"error": "type parameter is required"})
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	if ns == "" && k8s.RequiresNamespace(ctx, cl, rtype) {
+		badRequest(c, "namespace parameter is required")
 		return
 	}
 
-	rows, err := k8s.ListResources(ns, rtype)
+	rows, err := k8s.ListResources(ctx, cl, ns, rtype)
 	if err != nil {
 		log.Printf("Error listing resources (ns=%s, type=%s): %v", ns, rtype, err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 	c.JSON(200, rows)
 }
 
+// WatchResourcesSSE streams the resource table over SSE: a snapshot event
+// followed by added/modified/deleted row events. Every event carries the
+// resourceVersion as its id, so a reconnecting EventSource resumes from
+// Last-Event-ID instead of receiving a new snapshot.
+func WatchResourcesSSE(c *gin.Context) {
+	ns := c.Query("namespace")
+	rtype := c.Query("type")
+
+	if rtype == "" {
+		badRequest(c, "type parameter is required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	lookupCtx, cancel := requestContext(c)
+	needsNamespace := k8s.RequiresNamespace(lookupCtx, cl, rtype)
+	cancel()
+	if ns == "" && needsNamespace {
+		badRequest(c, "namespace parameter is required")
+		return
+	}
+
+	ctx := c.Request.Context()
+	events, err := k8s.WatchResources(ctx, cl, ns, rtype, c.GetHeader("Last-Event-ID"))
+	if err != nil {
+		log.Printf("Error watching resources (ns=%s, type=%s): %v", ns, rtype, err)
+		respondError(c, err)
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.Type == k8s.EventError {
+				sseError(c, ev.Err)
+				return
+			}
+			c.Render(-1, sse.Event{
+				Id:    ev.ResourceVersion,
+				Event: strings.ToLower(ev.Type),
+				Data:  ev,
+			})
+			c.Writer.Flush()
+		}
+	}
+}
+
+// GetOverview returns cluster-wide counts for the landing page. It is cached
+// for k8s.OverviewTTL, so polling it is cheap.
+func GetOverview(c *gin.Context) {
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	o, err := k8s.GetOverview(ctx, cl)
+	if err != nil {
+		log.Printf("Error computing cluster overview (cluster=%s): %v", cl.Name, err)
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, o)
+}
+
+// GetCacheStatus reports which resource informers are running for the
+// cluster and whether they have finished their initial sync.
+func GetCacheStatus(c *gin.Context) {
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, cl.ResourceCache().Status())
+}
+
+// cacheSizes reports the informer caches and metrics history of every
+// cluster for the /metrics endpoint.
+func cacheSizes() []metrics.CacheSize {
+	var out []metrics.CacheSize
+	for _, cl := range k8s.Clusters() {
+		if cl.Err != nil {
+			continue
+		}
+		for _, s := range cl.ResourceCache().Status() {
+			out = append(out, metrics.CacheSize{Cluster: cl.Name, Cache: "informer", Type: s.Type, Items: s.Items})
+		}
+		out = append(out, metrics.CacheSize{Cluster: cl.Name, Cache: "metrics-history", Type: "series", Items: k8s.MetricsHistorySeries(cl)})
+	}
+	return out
+}
+
 func GetPodDetails(c *gin.Context) {
 	ns := c.Query("namespace")
 	podName := c.Query("pod")
 
 	if ns == "" || podName == "" {
-		c.JSON(400, gin.H{"error": "namespace and pod parameters are required"})
+		badRequest(c, "namespace and pod parameters are required")
 		return
 	}
 
-	client := k8s.Clientset()
-	pod, err := client.CoreV1().Pods(ns).Get(context.TODO(), podName, metav1.GetOptions{})
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+	client := cl.Clientset
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+	pod, err := client.CoreV1().Pods(ns).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		log.Printf("Error getting pod details (ns=%s, pod=%s): %v", ns, podName, err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -123,22 +348,29 @@ func GetNodeDetails(c *gin.Context) {
 	nodeName := c.Query("node")
 
 	if nodeName == "" {
-		c.JSON(400, gin.H{"error": "node parameter is required"})
+		badRequest(c, "node parameter is required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
 		return
 	}
+	client := cl.Clientset
 
-	client := k8s.Clientset()
+	ctx, cancel := requestContext(c)
+	defer cancel()
 
 	// Get node info
-	node, err := client.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+	node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
 	if err != nil {
 		log.Printf("Error getting node details (node=%s): %v", nodeName, err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	// Get pods running on this node
-	pods, err := client.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
+	pods, err := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
 		FieldSelector: "spec.nodeName=" + nodeName,
 	})
 	if err != nil {
@@ -183,11 +415,19 @@ func GetNodeMetrics(c *gin.Context) {
 	nodeName := c.Query("node")
 
 	if nodeName == "" {
-		c.JSON(400, gin.H{"error": "node parameter is required"})
+		badRequest(c, "node parameter is required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
 		return
 	}
 
-	raw, err := k8s.GetNodeMetrics(nodeName)
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	raw, err := k8s.GetNodeMetrics(ctx, cl, nodeName)
 	if err != nil {
 		log.Printf("Node metrics not available (node=%s): %v", nodeName, err)
 		c.JSON(200, gin.H{
@@ -211,24 +451,31 @@ func GetServiceDetails(c *gin.Context) {
 	svcName := c.Query("service")
 
 	if ns == "" || svcName == "" {
-		c.JSON(400, gin.H{"error": "namespace and service parameters are required"})
+		badRequest(c, "namespace and service parameters are required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
 		return
 	}
+	client := cl.Clientset
 
-	client := k8s.Clientset()
+	ctx, cancel := requestContext(c)
+	defer cancel()
 
 	// Get service
-	svc, err := client.CoreV1().Services(ns).Get(context.TODO(), svcName, metav1.GetOptions{})
+	svc, err := client.CoreV1().Services(ns).Get(ctx, svcName, metav1.GetOptions{})
 	if err != nil {
 		log.Printf("Error getting service details (ns=%s, svc=%s): %v", ns, svcName, err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	log.Printf("Service %s found in namespace %s, type: %s", svcName, ns, svc.Spec.Type)
 
 	// Get endpoints
-	endpoints, err := client.CoreV1().Endpoints(ns).Get(context.TODO(), svcName, metav1.GetOptions{})
+	endpoints, err := client.CoreV1().Endpoints(ns).Get(ctx, svcName, metav1.GetOptions{})
 	endpointsList := []string{}
 
 	if err != nil {
@@ -291,15 +538,22 @@ func GetConfigMapDetails(c *gin.Context) {
 	cmName := c.Query("configmap")
 
 	if ns == "" || cmName == "" {
-		c.JSON(400, gin.H{"error": "namespace and configmap parameters are required"})
+		badRequest(c, "namespace and configmap parameters are required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
 		return
 	}
+	client := cl.Clientset
 
-	client := k8s.Clientset()
-	cm, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), cmName, metav1.GetOptions{})
+	ctx, cancel := requestContext(c)
+	defer cancel()
+	cm, err := client.CoreV1().ConfigMaps(ns).Get(ctx, cmName, metav1.GetOptions{})
 	if err != nil {
 		log.Printf("Error getting configmap details (ns=%s, cm=%s): %v", ns, cmName, err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -325,15 +579,22 @@ func GetPodContainers(c *gin.Context) {
 	podName := c.Query("pod")
 
 	if ns == "" || podName == "" {
-		c.JSON(400, gin.H{"error": "namespace and pod parameters are required"})
+		badRequest(c, "namespace and pod parameters are required")
 		return
 	}
 
-	client := k8s.Clientset()
-	pod, err := client.CoreV1().Pods(ns).Get(context.TODO(), podName, metav1.GetOptions{})
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+	client := cl.Clientset
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+	pod, err := client.CoreV1().Pods(ns).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		log.Printf("Error getting pod containers (ns=%s, pod=%s): %v", ns, podName, err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -358,32 +619,74 @@ func GetPodEvents(c *gin.Context) {
 	podName := c.Query("pod")
 
 	if ns == "" || podName == "" {
-		c.JSON(400, gin.H{"error": "namespace and pod parameters are required"})
+		badRequest(c, "namespace and pod parameters are required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
 		return
 	}
+	client := cl.Clientset
 
-	client := k8s.Clientset()
-	ev, err := client.CoreV1().Events(ns).List(context.TODO(), metav1.ListOptions{
-		FieldSelector: "involvedObject.name=" + podName,
+	ctx, cancel := requestContext(c)
+	defer cancel()
+	ev, err := client.CoreV1().Events(ns).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + podName,
 	})
 	if err != nil {
 		log.Printf("Error getting pod events (ns=%s, pod=%s): %v", ns, podName, err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 	c.JSON(200, ev.Items)
 }
 
+// DiagnosePod explains why a pod is unhealthy as a ranked list of findings.
+func DiagnosePod(c *gin.Context) {
+	ns := c.Query("namespace")
+	podName := c.Query("pod")
+
+	if ns == "" || podName == "" {
+		badRequest(c, "namespace and pod parameters are required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	d, err := k8s.DiagnosePod(ctx, cl, ns, podName)
+	if err != nil {
+		log.Printf("Error diagnosing pod (ns=%s, pod=%s): %v", ns, podName, err)
+		respondError(c, err)
+		return
+	}
+	c.JSON(200, d)
+}
+
 func GetPodMetrics(c *gin.Context) {
 	ns := c.Query("namespace")
 	podName := c.Query("pod")
 
 	if ns == "" || podName == "" {
-		c.JSON(400, gin.H{"error": "namespace and pod parameters are required"})
+		badRequest(c, "namespace and pod parameters are required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
 		return
 	}
 
-	raw, err := k8s.GetPodMetrics(ns, podName)
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	raw, err := k8s.GetPodMetrics(ctx, cl, ns, podName)
 	if err != nil {
 		log.Printf("Metrics not available (ns=%s, pod=%s): %v", ns, podName, err)
 		c.JSON(200, gin.H{
@@ -409,30 +712,53 @@ func GetPodMetrics(c *gin.Context) {
 	c.JSON(200, obj)
 }
 
+// StreamPodLogsSSE streams a pod's log (see logOptionsFromQuery for the
+// options), or delegates to the aggregated stream for selector/deployment.
+// With follow=false the stream ends once the current log has been sent.
 func StreamPodLogsSSE(c *gin.Context) {
 	ns := c.Query("namespace")
 	podName := c.Query("pod")
 	container := c.Query("container")
 
+	if ns != "" && podName == "" && (c.Query("selector") != "" || c.Query("deployment") != "") {
+		streamSelectorLogsSSE(c)
+		return
+	}
 	if ns == "" || podName == "" {
-		c.SSEvent("message", "ERROR: namespace and pod parameters are required\n")
+		badRequest(c, "namespace and one of pod, selector or deployment are required")
+		return
+	}
+	opts, msg := logOptionsFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
+		return
+	}
+	filter, msg := logFilterFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
+		return
+	}
+	parser, msg := logParserFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
 		return
 	}
 
-	log.Printf("Starting log stream: ns=%s, pod=%s, container=%s", ns, podName, container)
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
 
-	client := k8s.Clientset()
+	log.Printf("Starting log stream: cluster=%s, ns=%s, pod=%s, container=%s", cl.Name, ns, podName, container)
 
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("X-Accel-Buffering", "no")
-	c.Writer.Flush()
+	client := cl.Clientset
 
-	pod, err := client.CoreV1().Pods(ns).Get(context.TODO(), podName, metav1.GetOptions{})
+	getCtx, cancel := requestContext(c)
+	pod, err := client.CoreV1().Pods(ns).Get(getCtx, podName, metav1.GetOptions{})
+	cancel()
 	if err != nil {
 		log.Printf("Pod not found (ns=%s, pod=%s): %v", ns, podName, err)
-		c.SSEvent("message", fmt.Sprintf("ERROR: Pod not found: %v\n", err))
+		respondError(c, err)
 		return
 	}
 
@@ -453,42 +779,33 @@ func StreamPodLogsSSE(c *gin.Context) {
 			}
 		}
 		if !found {
-			c.SSEvent("message", fmt.Sprintf("ERROR: Container '%s' not found in pod\n", container))
+			respondError(c, APIError{
+				Code:    http.StatusNotFound,
+				Reason:  string(metav1.StatusReasonNotFound),
+				Message: fmt.Sprintf("container %q not found in pod %s", container, podName),
+			})
 			return
 		}
 	}
 
-	tail := int64(100)
-	req := client.CoreV1().Pods(ns).GetLogs(podName, &v1.PodLogOptions{
-		Container: container,
-		Follow:    true,
-		TailLines: &tail,
-	})
-
-	stream, err := req.Stream(context.TODO())
+	// The stream is bound to the request context only (no API deadline):
+	// when the browser disconnects the context is cancelled, which aborts the
+	// upstream read and closes the pod log connection.
+	ctx := c.Request.Context()
+	events, err := k8s.StreamPodLogs(ctx, cl, ns, podName, opts, k8s.ParseLogResume(c.GetHeader("Last-Event-ID")))
 	if err != nil {
 		log.Printf("Error opening log stream (ns=%s, pod=%s, container=%s): %v", ns, podName, container, err)
-		c.SSEvent("message", fmt.Sprintf("ERROR: Cannot open log stream: %v\n", err))
+		respondError(c, err)
 		return
 	}
-	defer stream.Close()
 
 	log.Printf("Log stream opened successfully")
 
-	buf := make([]byte, 4096)
-	for {
-		n, err := stream.Read(buf)
-		if n > 0 {
-			logLine := string(buf[:n])
-			c.SSEvent("message", logLine)
-			c.Writer.Flush()
-		}
-		if err != nil {
-			if err.Error() != "EOF" {
-				log.Printf("Log stream read error: %v", err)
-			}
-			return
-		}
-		time.Sleep(50 * time.Millisecond)
-	}
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.Flush()
+
+	writeLogEvents(c, k8s.FilterLogEvents(ctx, k8s.ParseLogEvents(ctx, events, parser), filter))
 }
@@ -0,0 +1,405 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"webk8s/internal/k8s"
+)
+
+// logOptionsFromQuery builds PodLogOptions from the request, starting from
+// k8s.DefaultLogOptions:
+//
+//	container           container name
+//	previous=true       log of the previous (crashed) container instance
+//	sinceSeconds=N      only lines newer than N seconds
+//	sinceTime=RFC3339   only lines after this time
+//	tailLines=N         last N lines (-1 for the whole log)
+//	timestamps=false    don't request timestamps (lines carry no ts or ID)
+//	limitBytes=N        stop after N bytes
+//	follow=false        return what's there instead of following
+//
+// It returns a non-empty message for invalid parameters.
+func logOptionsFromQuery(c *gin.Context) (*v1.PodLogOptions, string) {
+	opts := k8s.DefaultLogOptions()
+	opts.Container = c.Query("container")
+	opts.Previous = c.Query("previous") == "true"
+	if c.Query("timestamps") == "false" {
+		opts.Timestamps = false
+	}
+	if c.Query("follow") == "false" {
+		opts.Follow = false
+	}
+
+	if v := c.Query("tailLines"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < -1 {
+			return nil, "tailLines must be a number of lines (-1 for all)"
+		}
+		opts.TailLines = &n
+		if n == -1 {
+			opts.TailLines = nil
+		}
+	}
+
+	since, sinceTime := c.Query("sinceSeconds"), c.Query("sinceTime")
+	if since != "" && sinceTime != "" {
+		return nil, "only one of sinceSeconds and sinceTime may be set"
+	}
+	if since != "" {
+		n, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, "sinceSeconds must be a positive number of seconds"
+		}
+		opts.SinceSeconds = &n
+	}
+	if sinceTime != "" {
+		t, err := time.Parse(time.RFC3339, sinceTime)
+		if err != nil {
+			return nil, "sinceTime must be an RFC3339 time"
+		}
+		mt := metav1.NewTime(t)
+		opts.SinceTime = &mt
+	}
+
+	if v := c.Query("limitBytes"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, "limitBytes must be a positive number of bytes"
+		}
+		opts.LimitBytes = &n
+	}
+	return opts, ""
+}
+
+// logFilterFromQuery builds the optional server-side line filter:
+//
+//	include=REGEX       only lines matching REGEX (matches carry offsets)
+//	exclude=REGEX       drop lines matching REGEX
+//	ignoreCase=true     case-insensitive patterns
+//	before=N, after=N   context lines around matches; context=N sets both
+//
+// It returns a nil filter when neither pattern is given, and a non-empty
+// message for invalid parameters.
+func logFilterFromQuery(c *gin.Context) (*k8s.LogFilter, string) {
+	contextLines := func(key string) (int, bool) {
+		v := c.Query(key)
+		if v == "" {
+			v = c.DefaultQuery("context", "0")
+		}
+		n, err := strconv.Atoi(v)
+		return n, err == nil && n >= 0 && n <= k8s.MaxLogContext
+	}
+	before, ok := contextLines("before")
+	if !ok {
+		return nil, fmt.Sprintf("before/context must be between 0 and %d", k8s.MaxLogContext)
+	}
+	after, ok := contextLines("after")
+	if !ok {
+		return nil, fmt.Sprintf("after/context must be between 0 and %d", k8s.MaxLogContext)
+	}
+
+	f, err := k8s.NewLogFilter(c.Query("include"), c.Query("exclude"), c.Query("ignoreCase") == "true", before, after)
+	if err != nil {
+		return nil, "invalid filter pattern: " + err.Error()
+	}
+	return f, ""
+}
+
+// logParserFromQuery builds the optional JSON parsing stage: parse=json
+// adds a structured part to JSON lines, and each where=COND (such as
+// "level>=warn" or "field.user_id=123") keeps only JSON lines satisfying it.
+// Conditions imply parse=json.
+func logParserFromQuery(c *gin.Context) (*k8s.LogParser, string) {
+	where := c.QueryArray("where")
+	if c.Query("parse") != "json" && len(where) == 0 {
+		return nil, ""
+	}
+
+	p := &k8s.LogParser{}
+	for _, w := range where {
+		cond, err := k8s.ParseLogCondition(w)
+		if err != nil {
+			return nil, "invalid where condition: " + err.Error()
+		}
+		p.Conditions = append(p.Conditions, cond)
+	}
+	return p, ""
+}
+
+// GetLogs returns a finished snapshot of a pod's log, or of the logs of all
+// pods matching selector or deployment, as JSON lines {ts, pod, container,
+// line}. It takes the same options as the stream, without following.
+func GetLogs(c *gin.Context) {
+	ns := c.Query("namespace")
+	podName := c.Query("pod")
+	selector := c.Query("selector")
+	deployment := c.Query("deployment")
+
+	if ns == "" || (podName == "" && selector == "" && deployment == "") {
+		badRequest(c, "namespace and one of pod, selector or deployment are required")
+		return
+	}
+	opts, msg := logOptionsFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
+		return
+	}
+	opts.Follow = false
+	filter, msg := logFilterFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
+		return
+	}
+	parser, msg := logParserFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	var lines []k8s.LogEvent
+	var err error
+	if podName != "" {
+		lines, err = k8s.PodLogSnapshot(ctx, cl, ns, podName, opts)
+	} else {
+		if deployment != "" {
+			selector, err = k8s.DeploymentSelector(ctx, cl, ns, deployment)
+		}
+		if err == nil {
+			lines, err = k8s.SelectorLogSnapshot(ctx, cl, ns, selector, opts)
+		}
+	}
+	if err != nil {
+		log.Printf("Error reading logs (ns=%s, pod=%s, selector=%s): %v", ns, podName, selector, err)
+		respondError(c, err)
+		return
+	}
+
+	lines = filter.Apply(parser.Apply(lines))
+
+	c.JSON(200, gin.H{
+		"namespace": ns,
+		"lines":     lines,
+		"count":     len(lines),
+	})
+}
+
+// DownloadLogs streams a tar.gz (default) or zip archive of the logs of one
+// pod, the pods matching selector, the pods of a workload (kind and name), or
+// every pod in the namespace. previous=true adds previous-container logs and
+// describe=true a describe.json per pod. The archive is capped at
+// --log-archive-max-bytes of logs.
+func DownloadLogs(c *gin.Context) {
+	ns := c.Query("namespace")
+	podName := c.Query("pod")
+	selector := c.Query("selector")
+	kind := c.Query("kind")
+	name := c.Query("name")
+
+	if ns == "" {
+		badRequest(c, "namespace parameter is required")
+		return
+	}
+	if (kind == "") != (name == "") {
+		badRequest(c, "kind and name must be given together")
+		return
+	}
+	if kind != "" && !oneOf(kind, k8s.WorkloadKinds) {
+		badRequest(c, "kind must be one of deployments, statefulsets, daemonsets, replicasets, jobs")
+		return
+	}
+
+	opts := k8s.ArchiveOptions{
+		Format:   c.DefaultQuery("format", k8s.ArchiveTarGz),
+		Previous: c.Query("previous") == "true",
+		Describe: c.Query("describe") == "true",
+		MaxBytes: options.LogArchiveMaxBytes,
+	}
+	if opts.Format != k8s.ArchiveTarGz && opts.Format != k8s.ArchiveZip {
+		badRequest(c, "format must be tar.gz or zip")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	getCtx, cancel := requestContext(c)
+	defer cancel()
+
+	var pods []v1.Pod
+	if podName != "" {
+		pod, err := cl.Clientset.CoreV1().Pods(ns).Get(getCtx, podName, metav1.GetOptions{})
+		if err != nil {
+			log.Printf("Error getting pod for log archive (ns=%s, pod=%s): %v", ns, podName, err)
+			respondError(c, err)
+			return
+		}
+		pods = []v1.Pod{*pod}
+	} else {
+		if kind != "" {
+			sel, err := k8s.WorkloadSelector(getCtx, cl, ns, kind, name)
+			if err != nil {
+				log.Printf("Error getting workload selector (ns=%s, %s=%s): %v", ns, kind, name, err)
+				respondError(c, err)
+				return
+			}
+			selector = sel
+		}
+		list, err := cl.Clientset.CoreV1().Pods(ns).List(getCtx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			log.Printf("Error listing pods for log archive (ns=%s, selector=%s): %v", ns, selector, err)
+			respondError(c, err)
+			return
+		}
+		pods = list.Items
+	}
+	if len(pods) == 0 {
+		respondError(c, APIError{
+			Code:    http.StatusNotFound,
+			Reason:  string(metav1.StatusReasonNotFound),
+			Message: "no pods match the request",
+		})
+		return
+	}
+
+	base := ns
+	switch {
+	case podName != "":
+		base += "-" + podName
+	case name != "":
+		base += "-" + name
+	}
+	filename := fmt.Sprintf("logs-%s-%s.%s", base, time.Now().UTC().Format("20060102-150405"), opts.Format)
+
+	contentType := "application/gzip"
+	if opts.Format == k8s.ArchiveZip {
+		contentType = "application/zip"
+	}
+	c.Writer.Header().Set("Content-Type", contentType)
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// Log reads can take a while for many pods, so the archive is only bound
+	// to the client connection, not the API deadline.
+	if err := k8s.WriteLogArchive(c.Request.Context(), cl, c.Writer, pods, opts); err != nil {
+		// The status is already sent; all we can do is cut the archive short.
+		log.Printf("Error writing log archive (ns=%s): %v", ns, err)
+		c.Abort()
+	}
+}
+
+// streamSelectorLogsSSE follows every pod matching selector (or the pods of
+// deployment), stern-style. Every line event is tagged with its pod and
+// container; containers joining and leaving the stream are reported as
+// "attach" and "detach" events.
+func streamSelectorLogsSSE(c *gin.Context) {
+	ns := c.Query("namespace")
+	selector := c.Query("selector")
+	deployment := c.Query("deployment")
+	opts, msg := logOptionsFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
+		return
+	}
+	filter, msg := logFilterFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
+		return
+	}
+	parser, msg := logParserFromQuery(c)
+	if msg != "" {
+		badRequest(c, msg)
+		return
+	}
+	container := opts.Container
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	if deployment != "" {
+		getCtx, cancel := requestContext(c)
+		sel, err := k8s.DeploymentSelector(getCtx, cl, ns, deployment)
+		cancel()
+		if err != nil {
+			log.Printf("Error getting deployment selector (ns=%s, deployment=%s): %v", ns, deployment, err)
+			respondError(c, err)
+			return
+		}
+		selector = sel
+	}
+
+	log.Printf("Starting aggregated log stream: cluster=%s, ns=%s, selector=%s, container=%s", cl.Name, ns, selector, container)
+
+	ctx := c.Request.Context()
+	events, err := k8s.FollowSelectorLogs(ctx, cl, ns, selector, opts, k8s.ParseLogResume(c.GetHeader("Last-Event-ID")))
+	if err != nil {
+		log.Printf("Error starting aggregated log stream (ns=%s, selector=%s): %v", ns, selector, err)
+		respondError(c, err)
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.Flush()
+
+	writeLogEvents(c, k8s.FilterLogEvents(ctx, k8s.ParseLogEvents(ctx, events, parser), filter))
+}
+
+// writeLogEvents sends one SSE event per log event: "line" events carry
+// {ts, pod, container, line} (plus matches, context and structured when the
+// filter and parsing stages are on) with an event ID naming the line's
+// timestamp, container and sequence, so a reconnecting EventSource resumes
+// after the last line it received.
+// Heartbeat comments keep idle streams open through proxies.
+func writeLogEvents(c *gin.Context, events <-chan k8s.LogEvent) {
+	ctx := c.Request.Context()
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			switch ev.Type {
+			case k8s.LogErrorEvent:
+				log.Printf("Log stream read error (pod=%s, container=%s): %v", ev.Pod, ev.Container, ev.Err)
+				sseError(c, ev.Err)
+				return
+			case k8s.LogLineEvent:
+				c.Render(-1, sse.Event{Id: ev.EventID(), Event: ev.Type, Data: ev})
+			default:
+				c.SSEvent(ev.Type, ev)
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"webk8s/internal/k8s"
+)
+
+// Limits of /api/metrics/history.
+const (
+	defaultHistoryWindow = time.Hour
+	defaultHistoryPoints = 120
+	maxHistoryPoints     = 1000
+)
+
+// ListPodMetrics returns the usage of every pod in a namespace (all
+// namespaces when empty). sort=cpu or sort=memory orders by usage, highest
+// first; otherwise rows are ordered by namespace and name.
+func ListPodMetrics(c *gin.Context) {
+	ns := c.Query("namespace")
+	sortBy := c.Query("sort")
+	if sortBy != "" && sortBy != "cpu" && sortBy != "memory" {
+		badRequest(c, "sort must be cpu or memory")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	rows, err := k8s.ListPodMetrics(ctx, cl, ns)
+	if err != nil {
+		log.Printf("Error listing pod metrics (ns=%s): %v", ns, err)
+		respondError(c, err)
+		return
+	}
+
+	switch sortBy {
+	case "cpu":
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].CPU > rows[j].CPU })
+	case "memory":
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].Memory > rows[j].Memory })
+	}
+	c.JSON(200, rows)
+}
+
+// ListNodeMetrics returns the usage of every node. sort works as for
+// ListPodMetrics.
+func ListNodeMetrics(c *gin.Context) {
+	sortBy := c.Query("sort")
+	if sortBy != "" && sortBy != "cpu" && sortBy != "memory" {
+		badRequest(c, "sort must be cpu or memory")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	rows, err := k8s.ListNodeMetrics(ctx, cl)
+	if err != nil {
+		log.Printf("Error listing node metrics: %v", err)
+		respondError(c, err)
+		return
+	}
+
+	switch sortBy {
+	case "cpu":
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].CPU > rows[j].CPU })
+	case "memory":
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].Memory > rows[j].Memory })
+	}
+	c.JSON(200, rows)
+}
+
+// GetMetricsHistory returns the CPU/memory history of a pod (kind=pod,
+// namespace, name) or a node (kind=node, name) over the last window (default
+// 1h), averaged down to at most points samples per series. Pods get a total
+// series plus one per container. With a Prometheus metrics source the
+// history comes from range queries, and workloads (kind=deployments, ...)
+// can be charted too; otherwise it comes from the in-memory sampler.
+func GetMetricsHistory(c *gin.Context) {
+	kind := c.DefaultQuery("kind", k8s.HistoryPod)
+	ns := c.Query("namespace")
+	name := c.Query("name")
+	workload := slices.Contains(k8s.WorkloadKinds, kind)
+	if kind != k8s.HistoryPod && kind != k8s.HistoryNode && !workload {
+		badRequest(c, "kind must be pod, node or one of "+strings.Join(k8s.WorkloadKinds, ", "))
+		return
+	}
+	if name == "" || (kind != k8s.HistoryNode && ns == "") {
+		badRequest(c, "name (and namespace for pods and workloads) is required")
+		return
+	}
+
+	window := defaultHistoryWindow
+	if v := c.Query("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			badRequest(c, "window must be a positive duration like 15m or 1h")
+			return
+		}
+		window = d
+	}
+	points := defaultHistoryPoints
+	if v := c.Query("points"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryPoints {
+			badRequest(c, "points must be between 1 and "+strconv.Itoa(maxHistoryPoints))
+			return
+		}
+		points = n
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+	if workload && !k8s.HasMetricsRange(cl) {
+		badRequest(c, "workload history needs a Prometheus metrics source (--prometheus-url)")
+		return
+	}
+
+	var h *k8s.MetricsHistory
+	var found bool
+	var err error
+	if k8s.HasMetricsRange(cl) {
+		ctx, cancel := requestContext(c)
+		defer cancel()
+		h, found, err = k8s.MetricsRange(ctx, cl, kind, ns, name, window, points)
+	} else {
+		h, found, err = k8s.MetricsHistoryFor(cl, kind, ns, name, window, points)
+	}
+	if errors.Is(err, k8s.ErrHistoryDisabled) {
+		respondError(c, APIError{
+			Code:    http.StatusServiceUnavailable,
+			Reason:  "MetricsHistoryDisabled",
+			Message: "metrics history sampling is disabled (--metrics-interval=0)",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting metrics history (kind=%s, ns=%s, name=%s): %v", kind, ns, name, err)
+		respondError(c, err)
+		return
+	}
+	if !found {
+		respondError(c, APIError{
+			Code:    http.StatusNotFound,
+			Reason:  string(metav1.StatusReasonNotFound),
+			Message: "no metrics history for " + kind + " " + name,
+		})
+		return
+	}
+	c.JSON(200, h)
+}
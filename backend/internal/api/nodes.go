@@ -0,0 +1,162 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"webk8s/internal/audit"
+	"webk8s/internal/k8s"
+)
+
+// defaultDrainTimeout bounds a drain when the request sets no timeout.
+const defaultDrainTimeout = 5 * time.Minute
+
+// CordonNode marks a node unschedulable.
+func CordonNode(c *gin.Context) {
+	setNodeSchedulable(c, "node.cordon", true)
+}
+
+// UncordonNode marks a node schedulable again.
+func UncordonNode(c *gin.Context) {
+	setNodeSchedulable(c, "node.uncordon", false)
+}
+
+func setNodeSchedulable(c *gin.Context, action string, unschedulable bool) {
+	nodeName := c.Query("node")
+	if nodeName == "" {
+		badRequest(c, "node parameter is required")
+		return
+	}
+	dryRun := c.Query("dryRun") == "true"
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	rec := actionRecord(c, cl, action, "", "nodes", nodeName, dryRun)
+	if !mutationAllowed(c, rec) {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	if err := k8s.SetNodeUnschedulable(ctx, cl, nodeName, unschedulable, dryRun); err != nil {
+		actionFailed(c, rec, err)
+		return
+	}
+
+	rec.Outcome = audit.OutcomeSuccess
+	audit.Log(rec)
+	c.JSON(200, gin.H{
+		"node":          nodeName,
+		"unschedulable": unschedulable,
+		"dryRun":        dryRun,
+	})
+}
+
+// DrainNodeSSE cordons a node and evicts its pods, streaming one SSE event
+// per pod state change (evicting, blocked, evicted, failed, skipped) and a
+// final "done" event with the totals. Pods that can't be evicted under the
+// given options fail the request before anything is changed. Once started,
+// the drain runs to completion (or its timeout) even if the client
+// disconnects, and its outcome is audited either way.
+func DrainNodeSSE(c *gin.Context) {
+	nodeName := c.Query("node")
+	if nodeName == "" {
+		badRequest(c, "node parameter is required")
+		return
+	}
+
+	opts := k8s.DrainOptions{
+		IgnoreDaemonSets:   c.Query("ignoreDaemonSets") == "true",
+		DeleteEmptyDirData: c.Query("deleteEmptyDirData") == "true",
+		Force:              c.Query("force") == "true",
+		GracePeriod:        -1,
+		Timeout:            defaultDrainTimeout,
+		DryRun:             c.Query("dryRun") == "true",
+	}
+	if v := c.Query("gracePeriod"); v != "" {
+		grace, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || grace < 0 {
+			badRequest(c, "gracePeriod must be a non-negative number of seconds")
+			return
+		}
+		opts.GracePeriod = grace
+	}
+	if v := c.Query("timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			badRequest(c, "timeout must be a positive duration such as 5m")
+			return
+		}
+		opts.Timeout = timeout
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	rec := actionRecord(c, cl, "node.drain", "", "nodes", nodeName, opts.DryRun)
+	rec.Detail["ignoreDaemonSets"] = opts.IgnoreDaemonSets
+	rec.Detail["deleteEmptyDirData"] = opts.DeleteEmptyDirData
+	rec.Detail["force"] = opts.Force
+	if !mutationAllowed(c, rec) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	events, err := k8s.DrainNode(ctx, cl, nodeName, opts)
+	if err != nil {
+		actionFailed(c, rec, err)
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// Keep reading after a disconnect: the drain goes on and is audited when
+	// it finishes; only the writes stop.
+	for {
+		select {
+		case <-heartbeat.C:
+			if ctx.Err() == nil {
+				fmt.Fprint(c.Writer, ": heartbeat\n\n")
+				c.Writer.Flush()
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ctx.Err() == nil {
+				c.Render(-1, sse.Event{Event: ev.Type, Data: ev})
+				c.Writer.Flush()
+			}
+
+			if ev.Type == k8s.DrainDone {
+				rec.Detail["clientDisconnected"] = ctx.Err() != nil
+				rec.Outcome = audit.OutcomeSuccess
+				if ev.Failed > 0 {
+					rec.Outcome = audit.OutcomeFailed
+					rec.Error = ev.Message
+				}
+				rec.Detail["evicted"] = ev.Evicted
+				rec.Detail["failed"] = ev.Failed
+				audit.Log(rec)
+				return
+			}
+		}
+	}
+}
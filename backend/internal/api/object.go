@@ -0,0 +1,64 @@
+package api
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"webk8s/internal/k8s"
+)
+
+// GetObject returns the full manifest of any object as YAML (default) or
+// JSON. clean=true strips managedFields and the last-applied annotation,
+// status=false drops the status stanza.
+func GetObject(c *gin.Context) {
+	gvr := schema.GroupVersionResource{
+		Group:    c.Query("group"),
+		Version:  c.Query("version"),
+		Resource: c.Query("resource"),
+	}
+	ns := c.Query("namespace")
+	name := c.Query("name")
+	format := c.DefaultQuery("format", "yaml")
+
+	if gvr.Resource == "" || name == "" {
+		badRequest(c, "resource and name parameters are required")
+		return
+	}
+	if format != "yaml" && format != "json" {
+		badRequest(c, "format must be yaml or json")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	obj, err := k8s.GetObject(ctx, cl, gvr, ns, name, k8s.ObjectOptions{
+		Clean:      c.Query("clean") == "true",
+		DropStatus: c.Query("status") == "false",
+	})
+	if err != nil {
+		log.Printf("Error getting object (gvr=%s, ns=%s, name=%s): %v", gvr, ns, name, err)
+		respondError(c, err)
+		return
+	}
+
+	if format == "json" {
+		c.IndentedJSON(200, obj.Object)
+		return
+	}
+
+	out, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Data(200, "application/yaml; charset=utf-8", out)
+}
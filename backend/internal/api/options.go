@@ -0,0 +1,42 @@
+package api
+
+import "time"
+
+// Options holds the server-wide settings handlers consult at request time.
+type Options struct {
+	// APITimeout bounds every non-streaming Kubernetes API call a request
+	// makes; zero means only client disconnects cancel them.
+	APITimeout time.Duration
+
+	// ReadOnly disables every endpoint that changes cluster state.
+	ReadOnly bool
+
+	// TrustForwardedUser records the user from the authenticating proxy's
+	// X-Forwarded-User (and similar) headers in the audit log. Only enable
+	// it when every request passes through a proxy that sets them.
+	TrustForwardedUser bool
+
+	// LogArchiveMaxBytes caps the log bytes in one /api/logs/download
+	// archive; zero means no cap.
+	LogArchiveMaxBytes int64
+
+	// SecretReveal enables the secret value reveal endpoint.
+	SecretReveal bool
+	// SecretRevealNamespaces lists the namespaces whose secrets may be
+	// revealed; "*" allows every namespace.
+	SecretRevealNamespaces []string
+}
+
+var options Options
+
+func (o Options) secretRevealAllowed(namespace string) bool {
+	if !o.SecretReveal {
+		return false
+	}
+	for _, ns := range o.SecretRevealNamespaces {
+		if ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
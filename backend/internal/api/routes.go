@@ -4,11 +4,37 @@ import (
 	"log"
 
 	"github.com/gin-gonic/gin"
+
+	"webk8s/internal/metrics"
 )
 
-func RegisterRoutes(r *gin.Engine) {
+func RegisterRoutes(r *gin.Engine, opts Options) {
+	options = opts
+
+	// Prometheus metrics for webk8s itself
+	metrics.SetCacheSizes(cacheSizes)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	api := r.Group("/api")
 	{
+		// Cluster endpoints
+		api.GET("/clusters", func(c *gin.Context) {
+			log.Println("GET /api/clusters")
+			GetClusters(c)
+		})
+
+		// Cluster overview (landing page)
+		api.GET("/overview", func(c *gin.Context) {
+			log.Printf("GET /api/overview?cluster=%s", c.Query("cluster"))
+			GetOverview(c)
+		})
+
+		// Event browser
+		api.GET("/events", func(c *gin.Context) {
+			log.Printf("GET /api/events?namespace=%s&kind=%s&name=%s&type=%s&reason=%s", c.Query("namespace"), c.Query("kind"), c.Query("name"), c.Query("type"), c.Query("reason"))
+			ListEvents(c)
+		})
+
 		// Namespace and resource type endpoints
 		api.GET("/namespaces", func(c *gin.Context) {
 			log.Println("GET /api/namespaces")
@@ -21,10 +47,27 @@ func RegisterRoutes(r *gin.Engine) {
 		})
 
 		api.GET("/resources", func(c *gin.Context) {
-			log.Printf("GET /api/resources?namespace=%s&type=%s", c.Query("namespace"), c.Query("type"))
+			log.Printf("GET /api/resources?cluster=%s&namespace=%s&type=%s", c.Query("cluster"), c.Query("namespace"), c.Query("type"))
 			ListResources(c)
 		})
 
+		api.GET("/resources/watch", func(c *gin.Context) {
+			log.Printf("GET /api/resources/watch?cluster=%s&namespace=%s&type=%s", c.Query("cluster"), c.Query("namespace"), c.Query("type"))
+			WatchResourcesSSE(c)
+		})
+
+		api.GET("/cache", func(c *gin.Context) {
+			log.Printf("GET /api/cache?cluster=%s", c.Query("cluster"))
+			GetCacheStatus(c)
+		})
+
+		// Raw manifest of any object
+		api.GET("/object", func(c *gin.Context) {
+			log.Printf("GET /api/object?group=%s&version=%s&resource=%s&namespace=%s&name=%s",
+				c.Query("group"), c.Query("version"), c.Query("resource"), c.Query("namespace"), c.Query("name"))
+			GetObject(c)
+		})
+
 		// Pod detail endpoints
 		api.GET("/pod", func(c *gin.Context) {
 			log.Printf("GET /api/pod?namespace=%s&pod=%s", c.Query("namespace"), c.Query("pod"))
@@ -41,11 +84,32 @@ func RegisterRoutes(r *gin.Engine) {
 			GetPodEvents(c)
 		})
 
+		api.GET("/pod/diagnose", func(c *gin.Context) {
+			log.Printf("GET /api/pod/diagnose?namespace=%s&pod=%s", c.Query("namespace"), c.Query("pod"))
+			DiagnosePod(c)
+		})
+
 		api.GET("/pod/metrics", func(c *gin.Context) {
 			log.Printf("GET /api/pod/metrics?namespace=%s&pod=%s", c.Query("namespace"), c.Query("pod"))
 			GetPodMetrics(c)
 		})
 
+		// Metrics tables (kubectl top)
+		api.GET("/metrics/pods", func(c *gin.Context) {
+			log.Printf("GET /api/metrics/pods?namespace=%s&sort=%s", c.Query("namespace"), c.Query("sort"))
+			ListPodMetrics(c)
+		})
+
+		api.GET("/metrics/nodes", func(c *gin.Context) {
+			log.Printf("GET /api/metrics/nodes?sort=%s", c.Query("sort"))
+			ListNodeMetrics(c)
+		})
+
+		api.GET("/metrics/history", func(c *gin.Context) {
+			log.Printf("GET /api/metrics/history?kind=%s&namespace=%s&name=%s&window=%s", c.Query("kind"), c.Query("namespace"), c.Query("name"), c.Query("window"))
+			GetMetricsHistory(c)
+		})
+
 		// Node detail endpoints (NEW)
 		api.GET("/node", func(c *gin.Context) {
 			log.Printf("GET /api/node?node=%s", c.Query("node"))
@@ -57,6 +121,55 @@ func RegisterRoutes(r *gin.Engine) {
 			GetNodeMetrics(c)
 		})
 
+		// Deployment detail endpoints
+		api.GET("/deployment", func(c *gin.Context) {
+			log.Printf("GET /api/deployment?namespace=%s&deployment=%s", c.Query("namespace"), c.Query("deployment"))
+			GetDeploymentDetails(c)
+		})
+
+		api.GET("/deployment/diff", func(c *gin.Context) {
+			log.Printf("GET /api/deployment/diff?namespace=%s&deployment=%s&from=%s&to=%s",
+				c.Query("namespace"), c.Query("deployment"), c.Query("from"), c.Query("to"))
+			GetDeploymentDiff(c)
+		})
+
+		// Workload actions (JSON body required, disabled by --read-only, audited)
+		api.POST("/workload/scale", requireJSON, func(c *gin.Context) {
+			log.Printf("POST /api/workload/scale?namespace=%s&type=%s&name=%s&replicas=%s&dryRun=%s",
+				c.Query("namespace"), c.Query("type"), c.Query("name"), c.Query("replicas"), c.Query("dryRun"))
+			ScaleWorkload(c)
+		})
+
+		api.POST("/workload/restart", requireJSON, func(c *gin.Context) {
+			log.Printf("POST /api/workload/restart?namespace=%s&type=%s&name=%s&dryRun=%s",
+				c.Query("namespace"), c.Query("type"), c.Query("name"), c.Query("dryRun"))
+			RestartWorkload(c)
+		})
+
+		api.POST("/deployment/rollback", requireJSON, func(c *gin.Context) {
+			log.Printf("POST /api/deployment/rollback?namespace=%s&deployment=%s&revision=%s&dryRun=%s",
+				c.Query("namespace"), c.Query("deployment"), c.Query("revision"), c.Query("dryRun"))
+			RollbackDeployment(c)
+		})
+
+		// Node actions (JSON body required, disabled by --read-only, audited)
+		api.POST("/node/cordon", requireJSON, func(c *gin.Context) {
+			log.Printf("POST /api/node/cordon?node=%s&dryRun=%s", c.Query("node"), c.Query("dryRun"))
+			CordonNode(c)
+		})
+
+		api.POST("/node/uncordon", requireJSON, func(c *gin.Context) {
+			log.Printf("POST /api/node/uncordon?node=%s&dryRun=%s", c.Query("node"), c.Query("dryRun"))
+			UncordonNode(c)
+		})
+
+		api.POST("/node/drain", requireJSON, func(c *gin.Context) {
+			log.Printf("POST /api/node/drain?node=%s&ignoreDaemonSets=%s&deleteEmptyDirData=%s&force=%s&gracePeriod=%s&timeout=%s&dryRun=%s",
+				c.Query("node"), c.Query("ignoreDaemonSets"), c.Query("deleteEmptyDirData"), c.Query("force"),
+				c.Query("gracePeriod"), c.Query("timeout"), c.Query("dryRun"))
+			DrainNodeSSE(c)
+		})
+
 		// Service detail endpoints (NEW)
 		api.GET("/service", func(c *gin.Context) {
 			log.Printf("GET /api/service?namespace=%s&service=%s", c.Query("namespace"), c.Query("service"))
@@ -69,10 +182,33 @@ func RegisterRoutes(r *gin.Engine) {
 			GetConfigMapDetails(c)
 		})
 
-		// Log streaming endpoint
+		// Secret detail endpoints (values masked; reveal is opt-in and audited)
+		api.GET("/secret", func(c *gin.Context) {
+			log.Printf("GET /api/secret?namespace=%s&secret=%s", c.Query("namespace"), c.Query("secret"))
+			GetSecretDetails(c)
+		})
+
+		api.POST("/secret/reveal", requireJSON, func(c *gin.Context) {
+			log.Printf("POST /api/secret/reveal?namespace=%s&secret=%s&key=%s", c.Query("namespace"), c.Query("secret"), c.Query("key"))
+			RevealSecretValue(c)
+		})
+
+		// Log snapshot and streaming endpoints
+		api.GET("/logs", func(c *gin.Context) {
+			log.Printf("GET /api/logs?namespace=%s&pod=%s&selector=%s&deployment=%s&container=%s&previous=%s",
+				c.Query("namespace"), c.Query("pod"), c.Query("selector"), c.Query("deployment"), c.Query("container"), c.Query("previous"))
+			GetLogs(c)
+		})
+
+		api.GET("/logs/download", func(c *gin.Context) {
+			log.Printf("GET /api/logs/download?namespace=%s&pod=%s&selector=%s&kind=%s&name=%s&format=%s",
+				c.Query("namespace"), c.Query("pod"), c.Query("selector"), c.Query("kind"), c.Query("name"), c.Query("format"))
+			DownloadLogs(c)
+		})
+
 		api.GET("/logs/stream", func(c *gin.Context) {
-			log.Printf("GET /api/logs/stream?namespace=%s&pod=%s&container=%s",
-				c.Query("namespace"), c.Query("pod"), c.Query("container"))
+			log.Printf("GET /api/logs/stream?namespace=%s&pod=%s&selector=%s&deployment=%s&container=%s",
+				c.Query("namespace"), c.Query("pod"), c.Query("selector"), c.Query("deployment"), c.Query("container"))
 			StreamPodLogsSSE(c)
 		})
 	}
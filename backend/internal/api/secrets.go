@@ -0,0 +1,135 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"webk8s/internal/audit"
+	"webk8s/internal/k8s"
+)
+
+// GetSecretDetails returns a secret's key names and value sizes. Values are
+// always masked; use RevealSecretValue to read one.
+func GetSecretDetails(c *gin.Context) {
+	ns := c.Query("namespace")
+	secretName := c.Query("secret")
+
+	if ns == "" || secretName == "" {
+		badRequest(c, "namespace and secret parameters are required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+	client := cl.Clientset
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+
+	sec, err := client.CoreV1().Secrets(ns).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Error getting secret details (ns=%s, secret=%s): %v", ns, secretName, err)
+		respondError(c, err)
+		return
+	}
+
+	keys := make([]map[string]any, 0, len(sec.Data))
+	for k, v := range sec.Data {
+		keys = append(keys, map[string]any{
+			"name":  k,
+			"bytes": len(v),
+			"value": k8s.MaskedValue,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["name"].(string) < keys[j]["name"].(string) })
+
+	c.JSON(200, gin.H{
+		"name":       sec.Name,
+		"namespace":  sec.Namespace,
+		"type":       string(sec.Type),
+		"labels":     sec.Labels,
+		"keys":       keys,
+		"keyCount":   len(keys),
+		"revealable": options.secretRevealAllowed(sec.Namespace),
+	})
+}
+
+// RevealSecretValue returns the decoded value of one secret key. It is off
+// unless enabled with --secret-reveal, limited to the namespaces allowed by
+// --secret-reveal-namespaces, and every attempt is written to the audit log.
+func RevealSecretValue(c *gin.Context) {
+	ns := c.Query("namespace")
+	secretName := c.Query("secret")
+	key := c.Query("key")
+
+	if ns == "" || secretName == "" || key == "" {
+		badRequest(c, "namespace, secret and key parameters are required")
+		return
+	}
+
+	cl, ok := clusterFor(c)
+	if !ok {
+		return
+	}
+
+	rec := auditRecord(c, cl, "secret.reveal")
+	rec.Namespace = ns
+	rec.Resource = "secrets"
+	rec.Name = secretName
+	rec.Detail = map[string]any{"key": key}
+
+	if !options.secretRevealAllowed(ns) {
+		rec.Outcome = audit.OutcomeDenied
+		audit.Log(rec)
+		respondError(c, APIError{
+			Code:    http.StatusForbidden,
+			Reason:  "SecretRevealDisabled",
+			Message: "revealing secret values is disabled for this namespace",
+		})
+		return
+	}
+
+	client := cl.Clientset
+
+	ctx, cancel := requestContext(c)
+	defer cancel()
+	sec, err := client.CoreV1().Secrets(ns).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		rec.Outcome = audit.OutcomeFailed
+		rec.Error = err.Error()
+		audit.Log(rec)
+		log.Printf("Error getting secret (ns=%s, secret=%s): %v", ns, secretName, err)
+		respondError(c, err)
+		return
+	}
+
+	value, found := sec.Data[key]
+	if !found {
+		rec.Outcome = audit.OutcomeFailed
+		rec.Error = "key not found"
+		audit.Log(rec)
+		respondError(c, APIError{
+			Code:    http.StatusNotFound,
+			Reason:  string(metav1.StatusReasonNotFound),
+			Message: "key " + key + " not found in secret",
+			Details: gin.H{"name": secretName, "kind": "secrets", "key": key},
+		})
+		return
+	}
+
+	rec.Outcome = audit.OutcomeSuccess
+	audit.Log(rec)
+
+	c.JSON(200, gin.H{
+		"name":      sec.Name,
+		"namespace": sec.Namespace,
+		"key":       key,
+		"value":     string(value),
+	})
+}
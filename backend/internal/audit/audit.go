@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is one audit log entry. Every sensitive or mutating action writes
+// one record, whether it was allowed, denied or failed.
+type Record struct {
+	Time      time.Time      `json:"time"`
+	User      string         `json:"user"`
+	SourceIP  string         `json:"sourceIP"`
+	Action    string         `json:"action"`
+	Cluster   string         `json:"cluster,omitempty"`
+	Namespace string         `json:"namespace,omitempty"`
+	Resource  string         `json:"resource,omitempty"`
+	Name      string         `json:"name,omitempty"`
+	Outcome   string         `json:"outcome"`
+	Error     string         `json:"error,omitempty"`
+	Detail    map[string]any `json:"detail,omitempty"`
+}
+
+// Outcomes recorded in Record.Outcome.
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeFailed  = "failed"
+)
+
+var (
+	mu     sync.Mutex
+	out    io.Writer = os.Stderr
+	prefix           = "AUDIT "
+)
+
+// Open directs audit records to the file at path (appending), one JSON object
+// per line. An empty path keeps the default of writing "AUDIT"-prefixed lines
+// to stderr alongside the server log.
+func Open(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	mu.Lock()
+	out = f
+	prefix = ""
+	mu.Unlock()
+	return nil
+}
+
+// Log writes r as a single JSON line.
+func Log(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("audit: failed to encode record: %v", err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := fmt.Fprintf(out, "%s%s\n", prefix, b); err != nil {
+		log.Printf("audit: failed to write record: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// restartedAtAnnotation is the pod template annotation `kubectl rollout
+// restart` sets; changing it makes the controller roll every pod.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// Workload kinds accepted by the scale and restart actions.
+var (
+	ScalableKinds    = []string{"deployments", "statefulsets", "replicasets"}
+	RestartableKinds = []string{"deployments", "statefulsets", "daemonsets"}
+)
+
+// ScaleResult reports the replica count before and after a scale.
+type ScaleResult struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	From      int32  `json:"from"`
+	To        int32  `json:"to"`
+	DryRun    bool   `json:"dryRun"`
+}
+
+// RestartResult reports the restartedAt timestamp a restart applied.
+type RestartResult struct {
+	Kind        string `json:"kind"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	RestartedAt string `json:"restartedAt"`
+	DryRun      bool   `json:"dryRun"`
+}
+
+// RollbackResult reports the revision a deployment was rolled back to.
+type RollbackResult struct {
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	FromRevision int64  `json:"fromRevision"`
+	ToRevision   int64  `json:"toRevision"`
+	ReplicaSet   string `json:"replicaSet"`
+	Skipped      bool   `json:"skipped"`
+	DryRun       bool   `json:"dryRun"`
+}
+
+// ScaleWorkload sets the replica count of a deployment, statefulset or
+// replicaset through its scale subresource.
+func ScaleWorkload(ctx context.Context, cl *Cluster, kind, namespace, name string, replicas int32, dryRun bool) (*ScaleResult, error) {
+	apps := cl.Clientset.AppsV1()
+	opts := metav1.UpdateOptions{DryRun: dryRunOption(dryRun)}
+
+	var from, to int32
+	switch kind {
+	case "deployments":
+		scale, err := apps.Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		from = scale.Spec.Replicas
+		scale.Spec.Replicas = replicas
+		if scale, err = apps.Deployments(namespace).UpdateScale(ctx, name, scale, opts); err != nil {
+			return nil, err
+		}
+		to = scale.Spec.Replicas
+	case "statefulsets":
+		scale, err := apps.StatefulSets(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		from = scale.Spec.Replicas
+		scale.Spec.Replicas = replicas
+		if scale, err = apps.StatefulSets(namespace).UpdateScale(ctx, name, scale, opts); err != nil {
+			return nil, err
+		}
+		to = scale.Spec.Replicas
+	case "replicasets":
+		scale, err := apps.ReplicaSets(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		from = scale.Spec.Replicas
+		scale.Spec.Replicas = replicas
+		if scale, err = apps.ReplicaSets(namespace).UpdateScale(ctx, name, scale, opts); err != nil {
+			return nil, err
+		}
+		to = scale.Spec.Replicas
+	default:
+		return nil, unsupportedKind("scale", kind)
+	}
+
+	return &ScaleResult{Kind: kind, Namespace: namespace, Name: name, From: from, To: to, DryRun: dryRun}, nil
+}
+
+// RestartWorkload triggers a rolling restart the way `kubectl rollout
+// restart` does, by stamping the pod template with the current time.
+func RestartWorkload(ctx context.Context, cl *Cluster, kind, namespace, name string, dryRun bool) (*RestartResult, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]string{restartedAtAnnotation: now},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	apps := cl.Clientset.AppsV1()
+	opts := metav1.PatchOptions{DryRun: dryRunOption(dryRun)}
+
+	switch kind {
+	case "deployments":
+		_, err = apps.Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, opts)
+	case "statefulsets":
+		_, err = apps.StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, opts)
+	case "daemonsets":
+		_, err = apps.DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, opts)
+	default:
+		return nil, unsupportedKind("restart", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestartResult{Kind: kind, Namespace: namespace, Name: name, RestartedAt: now, DryRun: dryRun}, nil
+}
+
+// RollbackDeployment restores the pod template of the given revision, or of
+// the previous revision when revision is zero, like `kubectl rollout undo`.
+// Rolling back to the template already in use is reported as skipped.
+func RollbackDeployment(ctx context.Context, cl *Cluster, namespace, name string, revision int64, dryRun bool) (*RollbackResult, error) {
+	d, err := cl.Clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if d.Spec.Paused {
+		return nil, &apierrors.StatusError{ErrStatus: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusConflict,
+			Reason:  metav1.StatusReasonConflict,
+			Message: fmt.Sprintf("deployment %s is paused; resume it before rolling back", name),
+		}}
+	}
+
+	rsList, err := ownedReplicaSets(ctx, cl, d)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _ := parseRevision(d.Annotations[revisionAnnotation])
+	if revision == 0 {
+		for _, rs := range rsList {
+			if rev := replicaSetRevision(rs); rev < current {
+				revision = rev
+				break
+			}
+		}
+		if revision == 0 {
+			return nil, revisionNotFound(name, "no previous revision to roll back to")
+		}
+	}
+	target := findRevision(rsList, revision)
+	if target == nil {
+		return nil, revisionNotFound(name, fmt.Sprintf("revision %d not found", revision))
+	}
+
+	result := &RollbackResult{
+		Namespace:    namespace,
+		Name:         name,
+		FromRevision: current,
+		ToRevision:   revision,
+		ReplicaSet:   target.Name,
+		DryRun:       dryRun,
+	}
+
+	tmpl := target.Spec.Template.DeepCopy()
+	delete(tmpl.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	if apiequality.Semantic.DeepEqual(tmpl, &d.Spec.Template) {
+		result.Skipped = true
+		return result, nil
+	}
+
+	// Replace the whole template, guarded by the resourceVersion we read, so
+	// a concurrent edit fails instead of being merged into the old template.
+	patch, err := json.Marshal([]map[string]any{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": d.ResourceVersion},
+		{"op": "replace", "path": "/spec/template", "value": tmpl},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = cl.Clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.JSONPatchType, patch,
+		metav1.PatchOptions{DryRun: dryRunOption(dryRun)})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func dryRunOption(dryRun bool) []string {
+	if dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+func unsupportedKind(action, kind string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusBadRequest,
+		Reason:  metav1.StatusReasonBadRequest,
+		Message: fmt.Sprintf("cannot %s resource type %q", action, kind),
+	}}
+}
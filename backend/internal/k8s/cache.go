@@ -0,0 +1,133 @@
+package k8s
+
+import (
+	"sort"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResourceCache lazily starts one shared informer per resource type the first
+// time that type is listed, and serves listings from the informer's store
+// once it has synced.
+type ResourceCache struct {
+	factory informers.SharedInformerFactory
+	stop    chan struct{}
+
+	mu        sync.Mutex
+	informers map[string]informers.GenericInformer
+}
+
+// CacheStatus describes one informer in the cache.
+type CacheStatus struct {
+	Type   string `json:"type"`
+	Synced bool   `json:"synced"`
+	Items  int    `json:"items"`
+}
+
+func newResourceCache(cs kubernetes.Interface) *ResourceCache {
+	factory := informers.NewSharedInformerFactoryWithOptions(cs, 0,
+		informers.WithTransform(stripCachedObject))
+
+	return &ResourceCache{
+		factory:   factory,
+		stop:      make(chan struct{}),
+		informers: map[string]informers.GenericInformer{},
+	}
+}
+
+// ResourceCache returns the cluster's informer cache, creating it on first use.
+func (cl *Cluster) ResourceCache() *ResourceCache {
+	cl.cacheOnce.Do(func() {
+		cl.cache = newResourceCache(cl.Clientset)
+	})
+	return cl.cache
+}
+
+// informer returns the informer for rtype, registering and starting it if
+// this is the first request for that type.
+func (rc *ResourceCache) informer(rtype string) (informers.GenericInformer, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if inf, ok := rc.informers[rtype]; ok {
+		return inf, true
+	}
+
+	gvr, ok := resourceGVRs[rtype]
+	if !ok {
+		return nil, false
+	}
+	inf, err := rc.factory.ForResource(gvr)
+	if err != nil {
+		return nil, false
+	}
+
+	// Informer() registers the type with the factory; Start only launches
+	// informers that aren't running yet.
+	inf.Informer()
+	rc.factory.Start(rc.stop)
+	rc.informers[rtype] = inf
+	return inf, true
+}
+
+// List returns the cached objects of rtype in namespace (all namespaces when
+// empty). ok is false while the informer is still doing its initial sync, in
+// which case callers should fall back to a direct List.
+func (rc *ResourceCache) List(rtype, namespace string) ([]runtime.Object, bool) {
+	inf, ok := rc.informer(rtype)
+	if !ok || !inf.Informer().HasSynced() {
+		return nil, false
+	}
+
+	var objs []runtime.Object
+	var err error
+	if namespace == "" {
+		objs, err = inf.Lister().List(labels.Everything())
+	} else {
+		objs, err = inf.Lister().ByNamespace(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		return nil, false
+	}
+	return objs, true
+}
+
+// Status reports every informer started so far and whether it has synced.
+func (rc *ResourceCache) Status() []CacheStatus {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	out := make([]CacheStatus, 0, len(rc.informers))
+	for rtype, inf := range rc.informers {
+		out = append(out, CacheStatus{
+			Type:   rtype,
+			Synced: inf.Informer().HasSynced(),
+			Items:  len(inf.Informer().GetStore().ListKeys()),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out
+}
+
+// stripCachedObject drops metadata.managedFields before objects are stored,
+// since the table never shows them and they dominate object size. Secret
+// values are blanked too: rows only need the key names, and the cache should
+// never hold credentials.
+func stripCachedObject(obj any) (any, error) {
+	if acc, err := meta.Accessor(obj); err == nil {
+		acc.SetManagedFields(nil)
+	}
+	if sec, ok := obj.(*v1.Secret); ok {
+		for k := range sec.Data {
+			sec.Data[k] = nil
+		}
+		sec.StringData = nil
+	}
+	return obj, nil
+}
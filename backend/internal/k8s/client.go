@@ -1,38 +1,85 @@
 package k8s
 
 import (
-	"log"
-	"sync"
+	"fmt"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-)
+	"k8s.io/client-go/tools/clientcmd"
 
-var (
-	clientset *kubernetes.Clientset
-	once      sync.Once
+	"webk8s/internal/metrics"
 )
 
-func Clientset() *kubernetes.Clientset {
-	once.Do(func() {
-		cfg, err := rest.InClusterConfig()
-		if err != nil {
-			log.Fatalf("failed to get incluster config: %v", err)
-		}
-
-		cs, err := kubernetes.NewForConfig(cfg)
-		if err != nil {
-			log.Fatalf("failed to create clientset: %v", err)
-		}
-		clientset = cs
-	})
-	return clientset
+// ConfigOptions controls how the cluster registry is loaded.
+// All fields are optional; when empty the loader falls back to in-cluster
+// config and then to every context in $KUBECONFIG / ~/.kube/config.
+type ConfigOptions struct {
+	Kubeconfig string
+	Context    string
+
+	// ClustersFile points to a YAML/JSON file listing the clusters to serve.
+	// When set, Kubeconfig and Context are ignored.
+	ClustersFile string
+}
+
+var registry = &Registry{clusters: map[string]*Cluster{}}
+
+// Init loads the cluster registry. It only fails when no cluster at all could
+// be configured; per-cluster connection errors are kept on the Cluster and
+// reported through its health check.
+func Init(opts ConfigOptions) error {
+	reg, err := LoadRegistry(opts)
+	if err != nil {
+		return err
+	}
+	registry = reg
+	return nil
+}
+
+// GetCluster returns the named cluster, or the default cluster when name is
+// empty.
+func GetCluster(name string) (*Cluster, error) {
+	return registry.Get(name)
+}
+
+// Clusters returns every configured cluster in registration order.
+func Clusters() []*Cluster {
+	return registry.List()
 }
 
-func RestConfig() *rest.Config {
-	cfg, err := rest.InClusterConfig()
+func kubeconfigLoader(path, context string) clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if path != "" {
+		rules.ExplicitPath = path
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+func newCluster(name, context string, cfg *rest.Config, err error) *Cluster {
+	cl := &Cluster{Name: name, Context: context, Config: cfg, Err: err}
+	if cfg != nil {
+		cl.Server = cfg.Host
+	}
+	if err != nil {
+		return cl
+	}
+
+	cfg.Wrap(metrics.WrapTransport(name))
+
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		cl.Err = fmt.Errorf("failed to create clientset: %w", err)
+		return cl
+	}
+	cl.Clientset = cs
+
+	dyn, err := dynamic.NewForConfig(cfg)
 	if err != nil {
-		log.Fatalf("failed to get incluster config: %v", err)
+		cl.Err = fmt.Errorf("failed to create dynamic client: %w", err)
+		return cl
 	}
-	return cfg
+	cl.Dynamic = dyn
+	return cl
 }
@@ -0,0 +1,254 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// Errors returned by Registry.Get for names that aren't configured and for
+// clusters whose client could not be set up.
+var (
+	ErrUnknownCluster     = errors.New("unknown cluster")
+	ErrClusterUnavailable = errors.New("cluster unavailable")
+)
+
+// Cluster is one Kubernetes API server webk8s can browse.
+type Cluster struct {
+	Name      string
+	Context   string
+	Server    string
+	Config    *rest.Config
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+
+	// Err holds the configuration error for clusters that could not be set up.
+	Err error
+
+	cacheOnce sync.Once
+	cache     *ResourceCache
+
+	discoveryOnce  sync.Once
+	discoveryCache *discoveryCache
+
+	metricsOnce sync.Once
+	metricsRC   rest.Interface
+	metricsErr  error
+}
+
+// ClusterHealth is the health-check result reported by /api/clusters.
+type ClusterHealth struct {
+	Name    string `json:"name"`
+	Context string `json:"context,omitempty"`
+	Server  string `json:"server,omitempty"`
+	Default bool   `json:"default"`
+	Healthy bool   `json:"healthy"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Health probes the API server's /version endpoint.
+func (cl *Cluster) Health(ctx context.Context) ClusterHealth {
+	h := ClusterHealth{Name: cl.Name, Context: cl.Context, Server: cl.Server}
+	if cl.Err != nil {
+		h.Error = cl.Err.Error()
+		return h
+	}
+
+	raw, err := cl.Clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+
+	var info version.Info
+	if err := json.Unmarshal(raw, &info); err != nil {
+		h.Error = fmt.Sprintf("failed to parse version: %v", err)
+		return h
+	}
+	h.Healthy = true
+	h.Version = info.GitVersion
+	return h
+}
+
+// Registry holds the named clusters and which one is the default.
+type Registry struct {
+	mu       sync.RWMutex
+	clusters map[string]*Cluster
+	order    []string
+	def      string
+}
+
+func (r *Registry) add(cl *Cluster) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.clusters[cl.Name]; !ok {
+		r.order = append(r.order, cl.Name)
+	}
+	r.clusters[cl.Name] = cl
+	if r.def == "" {
+		r.def = cl.Name
+	}
+}
+
+// Get returns the named cluster, or the default one for an empty name.
+// Clusters that failed to configure are returned with their error.
+func (r *Registry) Get(name string) (*Cluster, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name == "" {
+		name = r.def
+	}
+	cl, ok := r.clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCluster, name)
+	}
+	if cl.Err != nil {
+		return cl, fmt.Errorf("%w: %q: %w", ErrClusterUnavailable, name, cl.Err)
+	}
+	return cl, nil
+}
+
+// Default returns the name of the default cluster.
+func (r *Registry) Default() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.def
+}
+
+// List returns the clusters in registration order.
+func (r *Registry) List() []*Cluster {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]*Cluster, 0, len(r.order))
+	for _, name := range r.order {
+		out = append(out, r.clusters[name])
+	}
+	return out
+}
+
+// DefaultCluster returns the name of the default cluster.
+func DefaultCluster() string {
+	return registry.Default()
+}
+
+// clustersFile is the on-disk format accepted by --clusters-config.
+type clustersFile struct {
+	Default  string        `json:"default"`
+	Clusters []ClusterSpec `json:"clusters"`
+}
+
+// ClusterSpec describes one entry of the clusters config file.
+type ClusterSpec struct {
+	Name       string `json:"name"`
+	Kubeconfig string `json:"kubeconfig"`
+	Context    string `json:"context"`
+	InCluster  bool   `json:"inCluster"`
+}
+
+// LoadRegistry builds a registry from a clusters file when one is given,
+// from in-cluster config when running in a pod, and otherwise from every
+// context in the kubeconfig (with the selected context as default).
+func LoadRegistry(opts ConfigOptions) (*Registry, error) {
+	reg := &Registry{clusters: map[string]*Cluster{}}
+
+	if opts.ClustersFile != "" {
+		if err := reg.loadFile(opts.ClustersFile); err != nil {
+			return nil, err
+		}
+		return reg, nil
+	}
+
+	if opts.Kubeconfig == "" && opts.Context == "" {
+		cfg, err := rest.InClusterConfig()
+		if err == nil {
+			reg.add(newCluster("in-cluster", "", cfg, nil))
+			return reg, nil
+		}
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, fmt.Errorf("failed to get incluster config: %w", err)
+		}
+	}
+
+	raw, err := kubeconfigLoader(opts.Kubeconfig, opts.Context).RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if len(raw.Contexts) == 0 {
+		return nil, errors.New("no kubeconfig contexts found and not running in a cluster")
+	}
+
+	current := opts.Context
+	if current == "" {
+		current = raw.CurrentContext
+	}
+	if _, ok := raw.Contexts[current]; !ok {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", current)
+	}
+
+	// Register the selected context first so it becomes the default.
+	names := []string{current}
+	for name := range raw.Contexts {
+		if name != current {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+
+	for _, name := range names {
+		cfg, err := kubeconfigLoader(opts.Kubeconfig, name).ClientConfig()
+		reg.add(newCluster(name, name, cfg, err))
+	}
+	return reg, nil
+}
+
+func (r *Registry) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read clusters config: %w", err)
+	}
+
+	var f clustersFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("failed to parse clusters config %s: %w", path, err)
+	}
+	if len(f.Clusters) == 0 {
+		return fmt.Errorf("clusters config %s defines no clusters", path)
+	}
+
+	for _, spec := range f.Clusters {
+		if spec.Name == "" {
+			return fmt.Errorf("clusters config %s: every cluster needs a name", path)
+		}
+
+		var cfg *rest.Config
+		var err error
+		if spec.InCluster {
+			cfg, err = rest.InClusterConfig()
+		} else {
+			cfg, err = kubeconfigLoader(spec.Kubeconfig, spec.Context).ClientConfig()
+		}
+		r.add(newCluster(spec.Name, spec.Context, cfg, err))
+	}
+
+	if f.Default != "" {
+		if _, ok := r.clusters[f.Default]; !ok {
+			return fmt.Errorf("clusters config %s: default cluster %q is not defined", path, f.Default)
+		}
+		r.def = f.Default
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	revisionAnnotation    = "deployment.kubernetes.io/revision"
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+)
+
+// Rollout states reported in RolloutStatus.State.
+const (
+	RolloutComplete    = "complete"
+	RolloutProgressing = "progressing"
+	RolloutStalled     = "stalled"
+	RolloutPaused      = "paused"
+)
+
+// DeploymentDetails is the payload of /api/deployment.
+type DeploymentDetails struct {
+	Name        string                       `json:"name"`
+	Namespace   string                       `json:"namespace"`
+	Labels      map[string]string            `json:"labels"`
+	Strategy    appsv1.DeploymentStrategy    `json:"strategy"`
+	Selector    string                       `json:"selector"`
+	Replicas    map[string]int32             `json:"replicas"`
+	Conditions  []appsv1.DeploymentCondition `json:"conditions"`
+	Containers  []map[string]string          `json:"containers"`
+	ReplicaSets []ReplicaSetRevision         `json:"replicaSets"`
+	Rollout     RolloutStatus                `json:"rollout"`
+}
+
+// ReplicaSetRevision is one ReplicaSet owned by a deployment.
+type ReplicaSetRevision struct {
+	Name        string   `json:"name"`
+	Revision    int64    `json:"revision"`
+	ChangeCause string   `json:"changeCause,omitempty"`
+	Replicas    int32    `json:"replicas"`
+	Ready       int32    `json:"ready"`
+	Images      []string `json:"images"`
+	Created     string   `json:"creationTimestamp"`
+	Current     bool     `json:"current"`
+}
+
+// RolloutStatus summarizes a deployment rollout the way
+// `kubectl rollout status` does.
+type RolloutStatus struct {
+	State   string `json:"state"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message"`
+}
+
+// RevisionDiff is a line diff between the pod templates of two revisions.
+type RevisionDiff struct {
+	From           int64      `json:"from"`
+	To             int64      `json:"to"`
+	FromReplicaSet string     `json:"fromReplicaSet"`
+	ToReplicaSet   string     `json:"toReplicaSet"`
+	Changed        bool       `json:"changed"`
+	Lines          []DiffLine `json:"lines"`
+}
+
+// GetDeploymentDetails returns a deployment with its owned ReplicaSets
+// (newest revision first) and computed rollout status.
+func GetDeploymentDetails(ctx context.Context, cl *Cluster, namespace, name string) (*DeploymentDetails, error) {
+	d, err := cl.Clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	rsList, err := ownedReplicaSets(ctx, cl, d)
+	if err != nil {
+		return nil, err
+	}
+
+	current := d.Annotations[revisionAnnotation]
+	replicaSets := make([]ReplicaSetRevision, 0, len(rsList))
+	for _, rs := range rsList {
+		replicas := int32(0)
+		if rs.Spec.Replicas != nil {
+			replicas = *rs.Spec.Replicas
+		}
+		images := []string{}
+		for _, ct := range rs.Spec.Template.Spec.Containers {
+			images = append(images, ct.Image)
+		}
+		replicaSets = append(replicaSets, ReplicaSetRevision{
+			Name:        rs.Name,
+			Revision:    replicaSetRevision(rs),
+			ChangeCause: rs.Annotations[changeCauseAnnotation],
+			Replicas:    replicas,
+			Ready:       rs.Status.ReadyReplicas,
+			Images:      images,
+			Created:     rs.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+			Current:     rs.Annotations[revisionAnnotation] == current,
+		})
+	}
+
+	containers := []map[string]string{}
+	for _, ct := range d.Spec.Template.Spec.Containers {
+		containers = append(containers, map[string]string{
+			"name":  ct.Name,
+			"image": ct.Image,
+		})
+	}
+
+	desired := int32(0)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+
+	return &DeploymentDetails{
+		Name:      d.Name,
+		Namespace: d.Namespace,
+		Labels:    d.Labels,
+		Strategy:  d.Spec.Strategy,
+		Selector:  metav1.FormatLabelSelector(d.Spec.Selector),
+		Replicas: map[string]int32{
+			"desired":     desired,
+			"current":     d.Status.Replicas,
+			"updated":     d.Status.UpdatedReplicas,
+			"ready":       d.Status.ReadyReplicas,
+			"available":   d.Status.AvailableReplicas,
+			"unavailable": d.Status.UnavailableReplicas,
+		},
+		Conditions:  d.Status.Conditions,
+		Containers:  containers,
+		ReplicaSets: replicaSets,
+		Rollout:     ComputeRolloutStatus(d),
+	}, nil
+}
+
+// ComputeRolloutStatus follows the checks of `kubectl rollout status`, and
+// additionally reports a rollout as stalled when its progress deadline was
+// exceeded or its ReplicaSet can't create pods.
+func ComputeRolloutStatus(d *appsv1.Deployment) RolloutStatus {
+	if d.Spec.Paused {
+		return RolloutStatus{State: RolloutPaused, Message: "rollout is paused"}
+	}
+	if d.Generation > d.Status.ObservedGeneration {
+		return RolloutStatus{State: RolloutProgressing, Message: "waiting for deployment spec update to be observed"}
+	}
+
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return RolloutStatus{State: RolloutStalled, Reason: cond.Reason, Message: cond.Message}
+		}
+		if cond.Type == appsv1.DeploymentReplicaFailure && cond.Status == v1.ConditionTrue {
+			return RolloutStatus{State: RolloutStalled, Reason: cond.Reason, Message: cond.Message}
+		}
+	}
+
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	st := d.Status
+
+	switch {
+	case st.UpdatedReplicas < desired:
+		return RolloutStatus{State: RolloutProgressing, Message: fmt.Sprintf("%d out of %d new replicas have been updated", st.UpdatedReplicas, desired)}
+	case st.Replicas > st.UpdatedReplicas:
+		return RolloutStatus{State: RolloutProgressing, Message: fmt.Sprintf("%d old replicas are pending termination", st.Replicas-st.UpdatedReplicas)}
+	case st.AvailableReplicas < st.UpdatedReplicas:
+		return RolloutStatus{State: RolloutProgressing, Message: fmt.Sprintf("%d of %d updated replicas are available", st.AvailableReplicas, st.UpdatedReplicas)}
+	}
+	return RolloutStatus{State: RolloutComplete, Message: "successfully rolled out"}
+}
+
+// DiffDeploymentRevisions diffs the pod templates of two revisions. A zero
+// to selects the current revision and a zero from the one before it.
+func DiffDeploymentRevisions(ctx context.Context, cl *Cluster, namespace, name string, from, to int64) (*RevisionDiff, error) {
+	d, err := cl.Clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rsList, err := ownedReplicaSets(ctx, cl, d)
+	if err != nil {
+		return nil, err
+	}
+	if len(rsList) == 0 {
+		return nil, revisionNotFound(name, "no ReplicaSets")
+	}
+
+	if to == 0 {
+		to = replicaSetRevision(rsList[0])
+	}
+	if from == 0 {
+		for _, rs := range rsList {
+			if rev := replicaSetRevision(rs); rev < to {
+				from = rev
+				break
+			}
+		}
+		if from == 0 {
+			return nil, revisionNotFound(name, fmt.Sprintf("no revision before %d", to))
+		}
+	}
+
+	fromRS := findRevision(rsList, from)
+	toRS := findRevision(rsList, to)
+	if fromRS == nil {
+		return nil, revisionNotFound(name, fmt.Sprintf("revision %d not found", from))
+	}
+	if toRS == nil {
+		return nil, revisionNotFound(name, fmt.Sprintf("revision %d not found", to))
+	}
+
+	a, err := templateLines(fromRS.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	b, err := templateLines(toRS.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := DiffLines(a, b)
+	changed := false
+	for _, l := range lines {
+		if l.Op != DiffEqual {
+			changed = true
+			break
+		}
+	}
+
+	return &RevisionDiff{
+		From:           from,
+		To:             to,
+		FromReplicaSet: fromRS.Name,
+		ToReplicaSet:   toRS.Name,
+		Changed:        changed,
+		Lines:          lines,
+	}, nil
+}
+
+// ownedReplicaSets returns the ReplicaSets controlled by d, newest revision first.
+func ownedReplicaSets(ctx context.Context, cl *Cluster, d *appsv1.Deployment) ([]*appsv1.ReplicaSet, error) {
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := cl.Clientset.AppsV1().ReplicaSets(d.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := []*appsv1.ReplicaSet{}
+	for i := range list.Items {
+		rs := &list.Items[i]
+		if ref := metav1.GetControllerOf(rs); ref != nil && ref.UID == d.UID {
+			out = append(out, rs)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return replicaSetRevision(out[i]) > replicaSetRevision(out[j]) })
+	return out, nil
+}
+
+// revisionNotFound reports a missing revision as a 404 so the API layer
+// translates it like any other missing object.
+func revisionNotFound(deployment, msg string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusNotFound,
+		Reason:  metav1.StatusReasonNotFound,
+		Message: fmt.Sprintf("deployment %s: %s", deployment, msg),
+	}}
+}
+
+func replicaSetRevision(rs *appsv1.ReplicaSet) int64 {
+	rev, _ := parseRevision(rs.Annotations[revisionAnnotation])
+	return rev
+}
+
+func parseRevision(v string) (int64, error) {
+	return strconv.ParseInt(v, 10, 64)
+}
+
+func findRevision(rsList []*appsv1.ReplicaSet, rev int64) *appsv1.ReplicaSet {
+	for _, rs := range rsList {
+		if replicaSetRevision(rs) == rev {
+			return rs
+		}
+	}
+	return nil
+}
+
+// templateLines renders a pod template as YAML lines, without the
+// pod-template-hash label that differs between every ReplicaSet.
+func templateLines(tmpl v1.PodTemplateSpec) ([]string, error) {
+	tmpl = *tmpl.DeepCopy()
+	delete(tmpl.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+
+	out, err := yaml.Marshal(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(out), "\n"), "\n"), nil
+}
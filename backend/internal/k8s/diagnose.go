@@ -0,0 +1,795 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Finding severities, most severe first.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+var severityRank = map[string]int{SeverityCritical: 0, SeverityWarning: 1, SeverityInfo: 2}
+
+// Thresholds of the pod analyzer.
+const (
+	frequentRestarts = 3
+	slowStart        = 5 * time.Minute
+	maxEvidence      = 3
+)
+
+// Finding is one problem the analyzer found, with a plain-language
+// explanation and what to try next. Evidence holds the status and event
+// messages it is based on.
+type Finding struct {
+	Severity    string   `json:"severity"`
+	Reason      string   `json:"reason"`
+	Container   string   `json:"container,omitempty"`
+	Explanation string   `json:"explanation"`
+	Suggestion  string   `json:"suggestion"`
+	Evidence    []string `json:"evidence,omitempty"`
+}
+
+// PodDiagnosis is the payload of /api/pod/diagnose. Findings are ordered by
+// severity; Healthy means none is critical or a warning.
+type PodDiagnosis struct {
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Phase     string    `json:"phase"`
+	Node      string    `json:"node,omitempty"`
+	Healthy   bool      `json:"healthy"`
+	Findings  []Finding `json:"findings"`
+}
+
+// podAnalyzer collects the findings for one pod.
+type podAnalyzer struct {
+	pod      *v1.Pod
+	events   []v1.Event
+	used     map[string]bool // event reasons already cited as evidence
+	findings []Finding
+}
+
+// DiagnosePod explains why a pod is unhealthy from its container statuses,
+// conditions, events, the ConfigMaps, Secrets and PVCs it references, and
+// its node.
+func DiagnosePod(ctx context.Context, cl *Cluster, namespace, name string) (*PodDiagnosis, error) {
+	core := cl.Clientset.CoreV1()
+	pod, err := core.Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	a := &podAnalyzer{pod: pod, used: map[string]bool{}}
+	if events, err := core.Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + name,
+	}); err == nil {
+		for _, ev := range events.Items {
+			// Skip events of an earlier pod with the same name.
+			if ev.InvolvedObject.UID == "" || ev.InvolvedObject.UID == pod.UID {
+				a.events = append(a.events, ev)
+			}
+		}
+		sort.SliceStable(a.events, func(i, j int) bool { return eventTime(a.events[i]).After(eventTime(a.events[j])) })
+	}
+
+	a.checkPodStatus()
+	a.checkScheduling()
+	a.checkContainers(pod.Status.InitContainerStatuses, true)
+	a.checkContainers(pod.Status.ContainerStatuses, false)
+	a.checkProbes()
+	a.checkReferences(ctx, cl)
+	a.checkNode(ctx, cl)
+	a.checkEvents()
+	a.checkReadiness()
+
+	sort.SliceStable(a.findings, func(i, j int) bool {
+		return severityRank[a.findings[i].Severity] < severityRank[a.findings[j].Severity]
+	})
+
+	d := &PodDiagnosis{
+		Namespace: namespace,
+		Pod:       name,
+		Phase:     string(pod.Status.Phase),
+		Node:      pod.Spec.NodeName,
+		Healthy:   true,
+		Findings:  a.findings,
+	}
+	if d.Findings == nil {
+		d.Findings = []Finding{}
+	}
+	for _, f := range d.Findings {
+		if f.Severity != SeverityInfo {
+			d.Healthy = false
+		}
+	}
+	return d, nil
+}
+
+func (a *podAnalyzer) add(f Finding) {
+	a.findings = append(a.findings, f)
+}
+
+// has reports whether a finding with one of reasons was already added.
+func (a *podAnalyzer) has(reasons ...string) bool {
+	for _, f := range a.findings {
+		for _, r := range reasons {
+			if f.Reason == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evidence returns the most recent distinct messages of Warning events with
+// one of reasons (for container, when set), and marks the reasons as used.
+func (a *podAnalyzer) evidence(container string, reasons ...string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, ev := range a.events {
+		if ev.Type != v1.EventTypeWarning || !slices.Contains(reasons, ev.Reason) {
+			continue
+		}
+		if container != "" && eventContainer(ev) != "" && eventContainer(ev) != container {
+			continue
+		}
+		a.used[ev.Reason] = true
+		if msg := strings.TrimSpace(ev.Message); msg != "" && !seen[msg] && len(out) < maxEvidence {
+			seen[msg] = true
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+func (a *podAnalyzer) checkPodStatus() {
+	st := a.pod.Status
+	switch {
+	case st.Reason == "Evicted":
+		a.add(Finding{
+			Severity:    SeverityCritical,
+			Reason:      "Evicted",
+			Explanation: "The kubelet evicted the pod because its node ran short of a resource (memory, disk or PIDs).",
+			Suggestion:  "Check the node's pressure conditions, set memory and ephemeral-storage requests that match real usage, and delete the evicted pod; its controller creates a replacement.",
+			Evidence:    nonEmpty(st.Message),
+		})
+	case st.Phase == v1.PodFailed:
+		a.add(Finding{
+			Severity:    SeverityCritical,
+			Reason:      firstNonEmpty(st.Reason, "PodFailed"),
+			Explanation: "The pod has failed and will not be restarted.",
+			Suggestion:  "Look at the terminated containers' exit codes and logs below; a Job's activeDeadlineSeconds or backoffLimit may also have ended it.",
+			Evidence:    nonEmpty(st.Message),
+		})
+	case st.Phase == v1.PodSucceeded:
+		a.add(Finding{
+			Severity:    SeverityInfo,
+			Reason:      "Completed",
+			Explanation: "All containers exited successfully; the pod has finished its work.",
+			Suggestion:  "Nothing to do unless the workload is meant to keep running, in which case its command exits too early.",
+		})
+	}
+
+	if a.pod.DeletionTimestamp != nil {
+		grace := int64(30)
+		if a.pod.DeletionGracePeriodSeconds != nil {
+			grace = *a.pod.DeletionGracePeriodSeconds
+		}
+		if time.Since(a.pod.DeletionTimestamp.Time) > time.Duration(grace)*time.Second+time.Minute {
+			a.add(Finding{
+				Severity:    SeverityWarning,
+				Reason:      "StuckTerminating",
+				Explanation: "The pod was deleted but is still present after its grace period.",
+				Suggestion:  "Check for finalizers (" + strings.Join(a.pod.Finalizers, ", ") + ") and whether the node is reachable; a pod on a lost node is only removed once the node is deleted or comes back.",
+			})
+		}
+	}
+}
+
+func (a *podAnalyzer) checkScheduling() {
+	for _, cond := range a.pod.Status.Conditions {
+		if cond.Type != v1.PodScheduled || cond.Status != v1.ConditionFalse {
+			continue
+		}
+		msg := cond.Message
+		suggestion := "Compare the pod's requests, nodeSelector, affinity and tolerations with the available nodes."
+		switch {
+		case strings.Contains(msg, "Insufficient"):
+			suggestion = "No node has enough free CPU or memory for the pod's requests. Lower the requests, free capacity, or add nodes."
+		case strings.Contains(msg, "node affinity") || strings.Contains(msg, "node selector"):
+			suggestion = "No node matches the pod's nodeSelector or node affinity. Check the node labels it requires."
+		case strings.Contains(msg, "taint"):
+			suggestion = "The matching nodes are tainted. Add a toleration for the taint or schedule onto other nodes."
+		case strings.Contains(msg, "PersistentVolumeClaim"):
+			suggestion = "A PersistentVolumeClaim isn't bound yet. Check that its StorageClass can provision a volume."
+		case strings.Contains(msg, "anti-affinity") || strings.Contains(msg, "affinity/selector"):
+			suggestion = "Pod (anti-)affinity rules rule out every node. Relax them or add nodes."
+		}
+		a.add(Finding{
+			Severity:    SeverityCritical,
+			Reason:      firstNonEmpty(cond.Reason, "Unschedulable"),
+			Explanation: "The scheduler cannot find a node for the pod.",
+			Suggestion:  suggestion,
+			Evidence:    appendUnique(nonEmpty(msg), a.evidence("", "FailedScheduling")...),
+		})
+	}
+}
+
+func (a *podAnalyzer) checkContainers(statuses []v1.ContainerStatus, init bool) {
+	kind := "Container"
+	if init {
+		kind = "Init container"
+	}
+
+	for _, cs := range statuses {
+		name := cs.Name
+		if cs.State.Waiting != nil {
+			a.checkWaiting(cs, kind)
+		}
+
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			a.add(terminatedFinding(kind, name, t, a.memoryLimit(name)))
+		}
+
+		if cs.State.Running != nil {
+			if t := cs.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" {
+				a.add(Finding{
+					Severity:    SeverityWarning,
+					Reason:      "RecentlyOOMKilled",
+					Container:   name,
+					Explanation: fmt.Sprintf("%s %s is running again, but its previous run was killed for exceeding its memory limit%s.", kind, name, limitText(a.memoryLimit(name))),
+					Suggestion:  "Raise the memory limit or reduce the application's memory use before it happens again.",
+				})
+			} else if cs.RestartCount >= frequentRestarts {
+				f := Finding{
+					Severity:    SeverityWarning,
+					Reason:      "FrequentRestarts",
+					Container:   name,
+					Explanation: fmt.Sprintf("%s %s has restarted %d times.", kind, name, cs.RestartCount),
+					Suggestion:  "Check the previous container's logs (previous=true) for why it stopped.",
+				}
+				if t != nil {
+					f.Explanation += " " + exitCodeMeaning(t)
+				}
+				a.add(f)
+			}
+		}
+	}
+}
+
+func (a *podAnalyzer) checkWaiting(cs v1.ContainerStatus, kind string) {
+	w := cs.State.Waiting
+	name := cs.Name
+	switch w.Reason {
+	case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull":
+		evidence := appendUnique(nonEmpty(w.Message), a.evidence(name, "Failed", "ErrImagePull", "BackOff")...)
+		msg := strings.Join(evidence, "\n")
+		suggestion := "Check the image name and tag, that the registry is reachable from the node, and the pod's imagePullSecrets."
+		switch {
+		case w.Reason == "InvalidImageName":
+			suggestion = "Fix the image reference in the pod spec."
+		case containsAny(msg, "not found", "manifest unknown", "does not exist"):
+			suggestion = "The image or tag doesn't exist in the registry. Check for typos and that the tag was pushed."
+		case containsAny(msg, "unauthorized", "authentication required", "denied", "forbidden"):
+			suggestion = "The registry refused the credentials. Add or fix the pod's imagePullSecrets (or the service account's)."
+		case containsAny(msg, "no such host", "i/o timeout", "connection refused", "TLS handshake"):
+			suggestion = "The node can't reach the registry. Check DNS, proxies and egress network policies from the node."
+		}
+		a.add(Finding{
+			Severity:    SeverityCritical,
+			Reason:      "ImagePullFailed",
+			Container:   name,
+			Explanation: fmt.Sprintf("%s %s can't start because image %q can't be pulled (%s).", kind, name, cs.Image, w.Reason),
+			Suggestion:  suggestion,
+			Evidence:    evidence,
+		})
+
+	case "CrashLoopBackOff":
+		f := Finding{
+			Severity:    SeverityCritical,
+			Reason:      "CrashLoopBackOff",
+			Container:   name,
+			Explanation: fmt.Sprintf("%s %s keeps exiting and Kubernetes is waiting longer between restarts (%d restarts so far).", kind, name, cs.RestartCount),
+			Suggestion:  "Check the previous container's logs (previous=true) for the error that makes it exit.",
+			Evidence:    appendUnique(nonEmpty(w.Message), a.evidence(name, "BackOff")...),
+		}
+		if t := cs.LastTerminationState.Terminated; t != nil {
+			if t.Reason == "OOMKilled" {
+				f.Reason = "OOMKilled"
+				f.Explanation = fmt.Sprintf("%s %s keeps being killed for exceeding its memory limit%s.", kind, name, limitText(a.memoryLimit(name)))
+				f.Suggestion = "Raise the memory limit, or find out why usage grows (leak, cache size, JVM/runtime heap settings)."
+			} else {
+				f.Explanation += " " + exitCodeMeaning(t)
+				f.Suggestion = exitCodeSuggestion(t)
+			}
+		}
+		a.add(f)
+
+	case "CreateContainerConfigError":
+		a.add(Finding{
+			Severity:    SeverityCritical,
+			Reason:      "CreateContainerConfigError",
+			Container:   name,
+			Explanation: fmt.Sprintf("%s %s can't be created because its configuration can't be resolved, usually a missing ConfigMap, Secret or key.", kind, name),
+			Suggestion:  "Create the referenced object or key (see the missing-reference findings), or mark the reference optional.",
+			Evidence:    appendUnique(nonEmpty(w.Message), a.evidence(name, "Failed")...),
+		})
+
+	case "CreateContainerError", "RunContainerError", "StartError":
+		a.add(Finding{
+			Severity:    SeverityCritical,
+			Reason:      w.Reason,
+			Container:   name,
+			Explanation: fmt.Sprintf("The container runtime failed to start %s %s.", strings.ToLower(kind), name),
+			Suggestion:  "Check that the command and working directory exist in the image and that volume mounts and security settings are valid.",
+			Evidence:    appendUnique(nonEmpty(w.Message), a.evidence(name, "Failed")...),
+		})
+
+	case "ContainerCreating", "PodInitializing":
+		if time.Since(a.pod.CreationTimestamp.Time) < slowStart {
+			return
+		}
+		a.add(Finding{
+			Severity:    SeverityWarning,
+			Reason:      "SlowStart",
+			Container:   name,
+			Explanation: fmt.Sprintf("%s %s has been %s for more than %s.", kind, name, w.Reason, slowStart),
+			Suggestion:  "This is usually a volume that can't be mounted or a sandbox/network setup failure; see the related events.",
+			Evidence:    a.evidence("", "FailedMount", "FailedAttachVolume", "FailedCreatePodSandBox"),
+		})
+	}
+}
+
+// checkProbes reports failing liveness, readiness and startup probes from
+// the kubelet's Unhealthy events.
+func (a *podAnalyzer) checkProbes() {
+	type probeFailure struct {
+		container, probe string
+		messages         []string
+	}
+	var failures []*probeFailure
+	byKey := map[string]*probeFailure{}
+
+	for _, ev := range a.events {
+		if ev.Reason != "Unhealthy" {
+			continue
+		}
+		probe := strings.SplitN(ev.Message, " ", 2)[0]
+		if probe != "Liveness" && probe != "Readiness" && probe != "Startup" {
+			continue
+		}
+		a.used[ev.Reason] = true
+		key := eventContainer(ev) + "/" + probe
+		pf := byKey[key]
+		if pf == nil {
+			pf = &probeFailure{container: eventContainer(ev), probe: probe}
+			byKey[key] = pf
+			failures = append(failures, pf)
+		}
+		if len(pf.messages) < maxEvidence && !slices.Contains(pf.messages, ev.Message) {
+			pf.messages = append(pf.messages, ev.Message)
+		}
+	}
+
+	for _, pf := range failures {
+		f := Finding{
+			Severity:  SeverityWarning,
+			Reason:    pf.probe + "ProbeFailing",
+			Container: pf.container,
+			Evidence:  pf.messages,
+		}
+		switch pf.probe {
+		case "Liveness":
+			f.Explanation = "The liveness probe fails, so the kubelet restarts the container."
+			f.Suggestion = "Make sure the probe's endpoint answers while the app is healthy; raise timeoutSeconds/failureThreshold or add a startup probe for slow starts."
+		case "Readiness":
+			f.Explanation = "The readiness probe fails, so the pod receives no Service traffic."
+			f.Suggestion = "Check that the app listens on the probed port and path and that its dependencies are reachable."
+		case "Startup":
+			f.Explanation = "The startup probe fails, so the kubelet keeps restarting the container before it finishes starting."
+			f.Suggestion = "Raise the startup probe's failureThreshold × periodSeconds to cover the app's real start time."
+		}
+		a.add(f)
+	}
+}
+
+// podReferences are the ConfigMaps, Secrets and PVCs a pod needs, with the
+// keys required of each (nil when the whole object is used).
+type podReferences struct {
+	configMaps map[string][]string
+	secrets    map[string][]string
+	pvcs       []string
+	pullSecret []string
+}
+
+func (r *podReferences) add(m map[string][]string, name string, keys ...string) {
+	if _, ok := m[name]; !ok {
+		m[name] = nil
+	}
+	m[name] = append(m[name], keys...)
+}
+
+func collectReferences(pod *v1.Pod) *podReferences {
+	refs := &podReferences{configMaps: map[string][]string{}, secrets: map[string][]string{}}
+	optional := func(b *bool) bool { return b != nil && *b }
+	itemKeys := func(items []v1.KeyToPath) []string {
+		keys := make([]string, 0, len(items))
+		for _, it := range items {
+			keys = append(keys, it.Key)
+		}
+		return keys
+	}
+
+	for _, vol := range pod.Spec.Volumes {
+		switch {
+		case vol.ConfigMap != nil && !optional(vol.ConfigMap.Optional):
+			refs.add(refs.configMaps, vol.ConfigMap.Name, itemKeys(vol.ConfigMap.Items)...)
+		case vol.Secret != nil && !optional(vol.Secret.Optional):
+			refs.add(refs.secrets, vol.Secret.SecretName, itemKeys(vol.Secret.Items)...)
+		case vol.PersistentVolumeClaim != nil:
+			refs.pvcs = append(refs.pvcs, vol.PersistentVolumeClaim.ClaimName)
+		case vol.Projected != nil:
+			for _, src := range vol.Projected.Sources {
+				if src.ConfigMap != nil && !optional(src.ConfigMap.Optional) {
+					refs.add(refs.configMaps, src.ConfigMap.Name, itemKeys(src.ConfigMap.Items)...)
+				}
+				if src.Secret != nil && !optional(src.Secret.Optional) {
+					refs.add(refs.secrets, src.Secret.Name, itemKeys(src.Secret.Items)...)
+				}
+			}
+		}
+	}
+
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		for _, from := range c.EnvFrom {
+			if from.ConfigMapRef != nil && !optional(from.ConfigMapRef.Optional) {
+				refs.add(refs.configMaps, from.ConfigMapRef.Name)
+			}
+			if from.SecretRef != nil && !optional(from.SecretRef.Optional) {
+				refs.add(refs.secrets, from.SecretRef.Name)
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil && !optional(ref.Optional) {
+				refs.add(refs.configMaps, ref.Name, ref.Key)
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil && !optional(ref.Optional) {
+				refs.add(refs.secrets, ref.Name, ref.Key)
+			}
+		}
+	}
+
+	for _, ps := range pod.Spec.ImagePullSecrets {
+		refs.pullSecret = append(refs.pullSecret, ps.Name)
+	}
+	return refs
+}
+
+// checkReferences looks up every ConfigMap, Secret and PVC the pod needs.
+// Lookups that fail for other reasons than NotFound (e.g. RBAC) are skipped.
+func (a *podAnalyzer) checkReferences(ctx context.Context, cl *Cluster) {
+	core := cl.Clientset.CoreV1()
+	ns := a.pod.Namespace
+	refs := collectReferences(a.pod)
+
+	for _, name := range sortedKeys(refs.configMaps) {
+		cm, err := core.ConfigMaps(ns).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			a.add(missingReference("ConfigMap", name))
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for _, key := range uniqueStrings(refs.configMaps[name]) {
+			_, inData := cm.Data[key]
+			_, inBinary := cm.BinaryData[key]
+			if !inData && !inBinary {
+				a.add(missingKey("ConfigMap", name, key))
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(refs.secrets) {
+		sec, err := core.Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			a.add(missingReference("Secret", name))
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for _, key := range uniqueStrings(refs.secrets[name]) {
+			if _, ok := sec.Data[key]; !ok {
+				a.add(missingKey("Secret", name, key))
+			}
+		}
+	}
+
+	for _, name := range uniqueStrings(refs.pullSecret) {
+		if _, err := core.Secrets(ns).Get(ctx, name, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+			a.add(Finding{
+				Severity:    SeverityWarning,
+				Reason:      "MissingImagePullSecret",
+				Explanation: fmt.Sprintf("Image pull secret %q doesn't exist, so private images can't be pulled with it.", name),
+				Suggestion:  "Create the secret (kubectl create secret docker-registry) or remove it from imagePullSecrets.",
+			})
+		}
+	}
+
+	for _, name := range uniqueStrings(refs.pvcs) {
+		pvc, err := core.PersistentVolumeClaims(ns).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			a.add(missingReference("PersistentVolumeClaim", name))
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		switch pvc.Status.Phase {
+		case v1.ClaimPending:
+			a.add(Finding{
+				Severity:    SeverityWarning,
+				Reason:      "PVCPending",
+				Explanation: fmt.Sprintf("PersistentVolumeClaim %q isn't bound to a volume yet.", name),
+				Suggestion:  "Check that its StorageClass exists and can provision volumes, or that a matching PersistentVolume is available. Claims with WaitForFirstConsumer bind only once the pod is scheduled.",
+			})
+		case v1.ClaimLost:
+			a.add(Finding{
+				Severity:    SeverityCritical,
+				Reason:      "PVCLost",
+				Explanation: fmt.Sprintf("PersistentVolumeClaim %q lost its underlying volume.", name),
+				Suggestion:  "The PersistentVolume was deleted; restore it from backup or recreate the claim.",
+			})
+		}
+	}
+}
+
+// checkNode reports problems of the node the pod runs on.
+func (a *podAnalyzer) checkNode(ctx context.Context, cl *Cluster) {
+	if a.pod.Spec.NodeName == "" {
+		return
+	}
+	node, err := cl.Clientset.CoreV1().Nodes().Get(ctx, a.pod.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady && cond.Status != v1.ConditionTrue {
+			a.add(Finding{
+				Severity:    SeverityCritical,
+				Reason:      "NodeNotReady",
+				Explanation: fmt.Sprintf("The pod's node %s is not ready, so the kubelet may not be running or reporting the pod's real state.", node.Name),
+				Suggestion:  "Check the node (kubelet, container runtime, network). Pods of controllers are rescheduled once the node is marked unreachable long enough.",
+				Evidence:    nonEmpty(cond.Message),
+			})
+		}
+	}
+}
+
+// checkEvents reports Warning events that no other finding explained.
+func (a *podAnalyzer) checkEvents() {
+	explained := map[string]string{
+		"FailedMount":            "A volume can't be mounted into the pod.",
+		"FailedAttachVolume":     "A volume can't be attached to the pod's node.",
+		"FailedCreatePodSandBox": "The pod's sandbox (network namespace) can't be created, usually a CNI problem on the node.",
+		"NetworkNotReady":        "The node's network plugin isn't ready.",
+		"FailedPostStartHook":    "The container's postStart hook failed, so it was killed.",
+		"FailedPreStopHook":      "The container's preStop hook failed.",
+	}
+
+	var reasons []string
+	for _, ev := range a.events {
+		if ev.Type == v1.EventTypeWarning && !a.used[ev.Reason] && !slices.Contains(reasons, ev.Reason) {
+			reasons = append(reasons, ev.Reason)
+		}
+	}
+	for _, reason := range reasons {
+		f := Finding{
+			Severity:    SeverityWarning,
+			Reason:      reason,
+			Explanation: explained[reason],
+			Suggestion:  "See the event messages for details.",
+			Evidence:    a.evidence("", reason),
+		}
+		if f.Explanation == "" {
+			f.Severity = SeverityInfo
+			f.Explanation = "Kubernetes reported a " + reason + " warning for the pod."
+		}
+		switch reason {
+		case "FailedMount", "FailedAttachVolume":
+			f.Suggestion = "Check that the referenced volumes exist and that the volume isn't still attached to another node (ReadWriteOnce)."
+		case "FailedCreatePodSandBox", "NetworkNotReady":
+			f.Suggestion = "Check the CNI plugin pods and logs on the node."
+		}
+		a.add(f)
+	}
+}
+
+// checkReadiness explains a running pod that isn't ready when nothing more
+// specific did.
+func (a *podAnalyzer) checkReadiness() {
+	if a.pod.Status.Phase != v1.PodRunning || a.has("ReadinessProbeFailing", "CrashLoopBackOff", "OOMKilled", "NodeNotReady") {
+		return
+	}
+	for _, cond := range a.pod.Status.Conditions {
+		if cond.Type == v1.PodReady && cond.Status != v1.ConditionTrue {
+			a.add(Finding{
+				Severity:    SeverityWarning,
+				Reason:      firstNonEmpty(cond.Reason, "NotReady"),
+				Explanation: "The pod is running but not ready, so Services don't send it traffic.",
+				Suggestion:  "Check which containers aren't ready and their readiness probes and readiness gates.",
+				Evidence:    nonEmpty(cond.Message),
+			})
+		}
+	}
+}
+
+// memoryLimit returns the memory limit of the named container, if any.
+func (a *podAnalyzer) memoryLimit(container string) string {
+	for _, c := range append(append([]v1.Container{}, a.pod.Spec.InitContainers...), a.pod.Spec.Containers...) {
+		if c.Name == container {
+			if q, ok := c.Resources.Limits[v1.ResourceMemory]; ok {
+				return q.String()
+			}
+		}
+	}
+	return ""
+}
+
+// terminatedFinding explains a container that stopped with a failure.
+func terminatedFinding(kind, name string, t *v1.ContainerStateTerminated, limit string) Finding {
+	f := Finding{
+		Severity:    SeverityCritical,
+		Reason:      firstNonEmpty(t.Reason, "Error"),
+		Container:   name,
+		Explanation: fmt.Sprintf("%s %s has terminated. %s", kind, name, exitCodeMeaning(t)),
+		Suggestion:  exitCodeSuggestion(t),
+		Evidence:    nonEmpty(t.Message),
+	}
+	if t.Reason == "OOMKilled" {
+		f.Explanation = fmt.Sprintf("%s %s was killed for exceeding its memory limit%s.", kind, name, limitText(limit))
+		f.Suggestion = "Raise the memory limit, or find out why usage grows (leak, cache size, JVM/runtime heap settings)."
+	}
+	return f
+}
+
+// exitCodeMeaning describes the last exit of a container.
+func exitCodeMeaning(t *v1.ContainerStateTerminated) string {
+	prefix := fmt.Sprintf("It last exited with code %d", t.ExitCode)
+	switch t.ExitCode {
+	case 0:
+		return prefix + " (success); its main process finished, but it is expected to keep running."
+	case 1:
+		return prefix + ", a generic application error."
+	case 126:
+		return prefix + ": the command isn't executable."
+	case 127:
+		return prefix + ": the command wasn't found in the image."
+	case 137:
+		return prefix + " (SIGKILL): it was killed, by the OOM killer, a failed liveness probe or after ignoring SIGTERM."
+	case 139:
+		return prefix + " (SIGSEGV): it crashed with a segmentation fault."
+	case 143:
+		return prefix + " (SIGTERM): it was asked to stop."
+	}
+	return prefix + "."
+}
+
+func exitCodeSuggestion(t *v1.ContainerStateTerminated) string {
+	switch t.ExitCode {
+	case 0:
+		return "Make the command run in the foreground, or use a Job if it is meant to finish."
+	case 126, 127:
+		return "Check the container's command and args against what exists in the image."
+	case 137:
+		return "Check for liveness probe failures and memory usage against the limit; check the previous container's logs (previous=true)."
+	}
+	return "Check the previous container's logs (previous=true) for the error."
+}
+
+func missingReference(kind, name string) Finding {
+	return Finding{
+		Severity:    SeverityCritical,
+		Reason:      "Missing" + kind,
+		Explanation: fmt.Sprintf("The pod references %s %q, which doesn't exist in its namespace.", kind, name),
+		Suggestion:  fmt.Sprintf("Create %s %q, fix the name in the pod spec, or mark the reference optional.", kind, name),
+	}
+}
+
+func missingKey(kind, name, key string) Finding {
+	return Finding{
+		Severity:    SeverityCritical,
+		Reason:      "Missing" + kind + "Key",
+		Explanation: fmt.Sprintf("The pod needs key %q of %s %q, which doesn't have it.", key, kind, name),
+		Suggestion:  fmt.Sprintf("Add the key to %s %q or fix the key name in the pod spec.", kind, name),
+	}
+}
+
+// eventContainer extracts the container name from an event's fieldPath,
+// e.g. "spec.containers{app}".
+func eventContainer(ev v1.Event) string {
+	fp := ev.InvolvedObject.FieldPath
+	start, end := strings.Index(fp, "{"), strings.LastIndex(fp, "}")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return fp[start+1 : end]
+}
+
+func eventTime(ev v1.Event) time.Time {
+	switch {
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	}
+	return ev.FirstTimestamp.Time
+}
+
+func limitText(limit string) string {
+	if limit == "" {
+		return ""
+	}
+	return " (" + limit + ")"
+}
+
+func nonEmpty(s string) []string {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func appendUnique(list []string, more ...string) []string {
+	for _, s := range more {
+		if !slices.Contains(list, s) && len(list) < maxEvidence {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func containsAny(s string, subs ...string) bool {
+	s = strings.ToLower(s)
+	for _, sub := range subs {
+		if strings.Contains(s, strings.ToLower(sub)) {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueStrings(list []string) []string {
+	var out []string
+	for _, s := range list {
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func podEvent(name, reason, message, fieldPath string, uid types.UID, ago time.Duration) *v1.Event {
+	return &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "shop", Name: name},
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web", UID: uid, FieldPath: fieldPath},
+		Type:           v1.EventTypeWarning,
+		Reason:         reason,
+		Message:        message,
+		LastTimestamp:  metav1.NewTime(time.Now().Add(-ago)),
+	}
+}
+
+func reasons(findings []Finding) []string {
+	var out []string
+	for _, f := range findings {
+		out = append(out, f.Severity+":"+f.Reason)
+	}
+	return out
+}
+
+func TestDiagnosePodRanking(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web", UID: "u1", CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))},
+		Spec: v1.PodSpec{
+			NodeName: "node-a",
+			Containers: []v1.Container{{
+				Name:      "app",
+				Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")}},
+				EnvFrom:   []v1.EnvFromSource{{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "settings"}}}},
+			}, {
+				Name: "proxy",
+			}},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionFalse, Reason: "ContainersNotReady"},
+			},
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:                 "app",
+				RestartCount:         7,
+				State:                v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 5m0s"}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+			}, {
+				Name:         "proxy",
+				RestartCount: 4,
+				State:        v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+			}},
+		},
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}},
+	}
+	cl := fakeCluster(nil, pod, node,
+		podEvent("e1", "BackOff", "Back-off restarting failed container", "spec.containers{app}", "u1", time.Minute),
+		podEvent("e2", "Unhealthy", "Readiness probe failed: connection refused", "spec.containers{proxy}", "u1", 2*time.Minute),
+		podEvent("e3", "FailedMount", "MountVolume.SetUp failed", "", "u1", 3*time.Minute),
+		podEvent("e4", "SomethingOdd", "odd", "", "u1", 4*time.Minute),
+		// An earlier pod of the same name.
+		podEvent("e5", "FailedScheduling", "0/3 nodes", "", "old", time.Minute),
+	)
+
+	d, err := DiagnosePod(context.Background(), cl, "shop", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"critical:OOMKilled",
+		"critical:MissingConfigMap",
+		"warning:FrequentRestarts",
+		"warning:ReadinessProbeFailing",
+		"warning:FailedMount",
+		"info:SomethingOdd",
+	}
+	if got := reasons(d.Findings); !reflect.DeepEqual(got, want) {
+		t.Fatalf("findings = %q, want %q", got, want)
+	}
+	if d.Healthy {
+		t.Error("healthy with critical findings")
+	}
+
+	oom := d.Findings[0]
+	if oom.Container != "app" || !strings.Contains(oom.Explanation, "(128Mi)") ||
+		!reflect.DeepEqual(oom.Evidence, []string{"back-off 5m0s", "Back-off restarting failed container"}) {
+		t.Errorf("OOM finding = %+v", oom)
+	}
+	if probe := d.Findings[3]; probe.Container != "proxy" || len(probe.Evidence) != 1 {
+		t.Errorf("probe finding = %+v", probe)
+	}
+}
+
+func TestDiagnosePodHealthy(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"},
+		Status:     v1.PodStatus{Phase: v1.PodSucceeded},
+	}
+	d, err := DiagnosePod(context.Background(), fakeCluster(nil, pod), "shop", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Healthy || !reflect.DeepEqual(reasons(d.Findings), []string{"info:Completed"}) {
+		t.Errorf("diagnosis = %+v", d)
+	}
+}
+
+func TestDiagnoseImagePullSuggestion(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"manifest unknown: tag v9 not found", "doesn't exist in the registry"},
+		{"pull access denied, authentication required", "refused the credentials"},
+		{"dial tcp: lookup registry.local: no such host", "can't reach the registry"},
+		{"something else", "Check the image name and tag"},
+	}
+	for _, tt := range tests {
+		a := &podAnalyzer{pod: &v1.Pod{}, used: map[string]bool{}}
+		a.checkWaiting(v1.ContainerStatus{
+			Name:  "app",
+			Image: "registry.local/web:v9",
+			State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: tt.message}},
+		}, "Container")
+		if len(a.findings) != 1 || a.findings[0].Reason != "ImagePullFailed" || !strings.Contains(a.findings[0].Suggestion, tt.want) {
+			t.Errorf("%q: findings = %+v, want a suggestion containing %q", tt.message, a.findings, tt.want)
+		}
+	}
+}
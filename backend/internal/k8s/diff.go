@@ -0,0 +1,59 @@
+package k8s
+
+// Diff operations reported in DiffLine.Op.
+const (
+	DiffEqual  = " "
+	DiffAdd    = "+"
+	DiffRemove = "-"
+)
+
+// DiffLine is one line of a line-based diff.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffLines computes a longest-common-subsequence line diff of a and b.
+// Inputs are small (pod templates), so the quadratic table is fine.
+func DiffLines(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	out := make([]DiffLine, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, DiffLine{Op: DiffEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{Op: DiffRemove, Text: a[i]})
+			i++
+		default:
+			out = append(out, DiffLine{Op: DiffAdd, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, DiffLine{Op: DiffRemove, Text: a[i]})
+	}
+	for ; j < m; j++ {
+		out = append(out, DiffLine{Op: DiffAdd, Text: b[j]})
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, ",")
+	}
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", ""},
+		{"x", "x", " x"},
+		{"", "x,y", "+x,+y"},
+		{"x,y", "", "-x,-y"},
+		{"a,b,c", "a,c", " a,-b, c"},
+		{"a,c", "a,b,c", " a,+b, c"},
+		{"image: v1,replicas: 2", "image: v2,replicas: 2", "-image: v1,+image: v2, replicas: 2"},
+		{"a,b,c,d", "b,d,e", "-a, b,-c, d,+e"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, l := range DiffLines(split(tt.a), split(tt.b)) {
+			got = append(got, l.Op+l.Text)
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("DiffLines(%q, %q) = %q, want %q", tt.a, tt.b, strings.Join(got, ","), tt.want)
+		}
+	}
+}
+
+func TestDiffLinesReconstructs(t *testing.T) {
+	a := strings.Split("spec:,containers:,- name: app,image: web:1,env:,- name: A,value: 1,ports:,- 80", ",")
+	b := strings.Split("spec:,containers:,- name: app,image: web:2,env:,- name: B,value: 1,- name: A,value: 1,resources: {}", ",")
+
+	var gotA, gotB []string
+	equal := 0
+	for _, l := range DiffLines(a, b) {
+		switch l.Op {
+		case DiffEqual:
+			gotA, gotB = append(gotA, l.Text), append(gotB, l.Text)
+			equal++
+		case DiffRemove:
+			gotA = append(gotA, l.Text)
+		case DiffAdd:
+			gotB = append(gotB, l.Text)
+		default:
+			t.Fatalf("unknown op %q", l.Op)
+		}
+	}
+	if !reflect.DeepEqual(gotA, a) || !reflect.DeepEqual(gotB, b) {
+		t.Errorf("diff doesn't rebuild its inputs:\n%q\n%q", gotA, gotB)
+	}
+	// spec, containers, name, env, "- name: A", "value: 1" are common.
+	if equal != 6 {
+		t.Errorf("%d equal lines, want the longest common subsequence of 6", equal)
+	}
+}
@@ -0,0 +1,273 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Drain event types, one per pod state change plus the final summary.
+const (
+	DrainPlan     = "plan"
+	DrainSkipped  = "skipped"
+	DrainEvicting = "evicting"
+	DrainBlocked  = "blocked"
+	DrainEvicted  = "evicted"
+	DrainFailed   = "failed"
+	DrainDone     = "done"
+)
+
+// evictionRetryInterval is how long to wait before retrying an eviction a
+// PodDisruptionBudget refused, and podDeletePollInterval how often to check
+// whether an evicted pod is gone.
+const (
+	evictionRetryInterval = 5 * time.Second
+	podDeletePollInterval = time.Second
+)
+
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// DrainOptions mirrors the flags of `kubectl drain`.
+type DrainOptions struct {
+	IgnoreDaemonSets   bool
+	DeleteEmptyDirData bool
+	// Force evicts pods that no controller will recreate.
+	Force bool
+	// GracePeriod overrides the pods' termination grace period when >= 0.
+	GracePeriod int64
+	// Timeout bounds the whole drain; zero means no limit.
+	Timeout time.Duration
+	DryRun  bool
+}
+
+// DrainEvent is one progress message of a drain.
+type DrainEvent struct {
+	Type      string `json:"type"`
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Message   string `json:"message,omitempty"`
+
+	// Only meaningful on DrainPlan and DrainDone; always sent so a real 0
+	// is distinguishable from a missing count.
+	Total   int `json:"total"`
+	Evicted int `json:"evicted"`
+	Failed  int `json:"failed"`
+}
+
+// SetNodeUnschedulable cordons (true) or uncordons (false) a node.
+func SetNodeUnschedulable(ctx context.Context, cl *Cluster, name string, unschedulable, dryRun bool) error {
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{"unschedulable": unschedulable},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cl.Clientset.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, patch,
+		metav1.PatchOptions{DryRun: dryRunOption(dryRun)})
+	return err
+}
+
+// DrainNode cordons a node and evicts its pods through the Eviction API, so
+// PodDisruptionBudgets are honored: evictions a budget refuses are reported
+// as blocked and retried until they succeed or the drain times out.
+//
+// Like kubectl, the node's pods are checked before anything is evicted; pods
+// that the options don't allow evicting fail the whole drain up front. ctx
+// only bounds those checks and the cordon: the evictions run detached from it,
+// bounded by opts.Timeout, so a client that goes away doesn't leave the node
+// half drained. The caller must read the channel until it is closed, which
+// happens right after the DrainDone event.
+func DrainNode(ctx context.Context, cl *Cluster, name string, opts DrainOptions) (<-chan DrainEvent, error) {
+	pods, err := cl.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var evict []v1.Pod
+	var skipped []DrainEvent
+	var problems []string
+	for _, pod := range pods.Items {
+		skip, problem := drainFilter(&pod, opts)
+		switch {
+		case problem != "":
+			problems = append(problems, fmt.Sprintf("%s/%s: %s", pod.Namespace, pod.Name, problem))
+		case skip != "":
+			skipped = append(skipped, DrainEvent{Type: DrainSkipped, Namespace: pod.Namespace, Pod: pod.Name, Message: skip})
+		default:
+			evict = append(evict, pod)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &apierrors.StatusError{ErrStatus: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusUnprocessableEntity,
+			Reason:  metav1.StatusReasonInvalid,
+			Message: "cannot drain node " + name + ": " + strings.Join(problems, "; "),
+		}}
+	}
+
+	if err := SetNodeUnschedulable(ctx, cl, name, true, opts.DryRun); err != nil {
+		return nil, err
+	}
+
+	d := &drainer{cl: cl, opts: opts, out: make(chan DrainEvent)}
+	go d.run(context.WithoutCancel(ctx), evict, skipped)
+	return d.out, nil
+}
+
+// drainFilter decides what to do with a pod: evict it (both empty), skip it
+// with a reason, or refuse to drain because of it.
+func drainFilter(pod *v1.Pod, opts DrainOptions) (skip, problem string) {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return "mirror pod managed by the kubelet", ""
+	}
+	finished := pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+
+	ref := metav1.GetControllerOf(pod)
+	if ref != nil && ref.Kind == "DaemonSet" {
+		if opts.IgnoreDaemonSets {
+			return "DaemonSet-managed pod", ""
+		}
+		return "", "managed by a DaemonSet (use ignoreDaemonSets)"
+	}
+	if ref == nil && !finished && !opts.Force {
+		return "", "not managed by a controller (use force)"
+	}
+	if !finished && !opts.DeleteEmptyDirData {
+		for _, vol := range pod.Spec.Volumes {
+			if vol.EmptyDir != nil {
+				return "", "uses emptyDir volume " + vol.Name + " (use deleteEmptyDirData)"
+			}
+		}
+	}
+	return "", ""
+}
+
+type drainer struct {
+	cl   *Cluster
+	opts DrainOptions
+	out  chan DrainEvent
+}
+
+func (d *drainer) run(ctx context.Context, pods []v1.Pod, skipped []DrainEvent) {
+	defer close(d.out)
+
+	d.out <- DrainEvent{Type: DrainPlan, Total: len(pods)}
+	for _, ev := range skipped {
+		d.out <- ev
+	}
+
+	// Evictions stop at the timeout; the events reporting the failures are
+	// still sent after it.
+	if d.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.opts.Timeout)
+		defer cancel()
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	evicted, failed := 0, 0
+	for i := range pods {
+		wg.Add(1)
+		go func(pod *v1.Pod) {
+			defer wg.Done()
+			ok := d.evict(ctx, pod)
+			mu.Lock()
+			if ok {
+				evicted++
+			} else {
+				failed++
+			}
+			mu.Unlock()
+		}(&pods[i])
+	}
+	wg.Wait()
+
+	msg := "node drained"
+	if failed > 0 {
+		msg = fmt.Sprintf("%d pods could not be evicted", failed)
+	}
+	d.out <- DrainEvent{Type: DrainDone, Total: len(pods), Evicted: evicted, Failed: failed, Message: msg}
+}
+
+// evict evicts one pod, retrying while a PodDisruptionBudget blocks it, and
+// waits for the pod to be deleted.
+func (d *drainer) evict(ctx context.Context, pod *v1.Pod) bool {
+	ev := DrainEvent{Namespace: pod.Namespace, Pod: pod.Name}
+	send := func(typ, msg string) {
+		ev.Type, ev.Message = typ, msg
+		d.out <- ev
+	}
+
+	eviction := &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{DryRun: dryRunOption(d.opts.DryRun)},
+	}
+	if d.opts.GracePeriod >= 0 {
+		grace := d.opts.GracePeriod
+		eviction.DeleteOptions.GracePeriodSeconds = &grace
+	}
+
+	send(DrainEvicting, "")
+	for {
+		err := d.cl.Clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		if err == nil || apierrors.IsNotFound(err) {
+			break
+		}
+		if !apierrors.IsTooManyRequests(err) {
+			send(DrainFailed, err.Error())
+			return false
+		}
+
+		send(DrainBlocked, err.Error())
+		select {
+		case <-ctx.Done():
+			send(DrainFailed, "timed out waiting for the disruption budget to allow eviction")
+			return false
+		case <-time.After(evictionRetryInterval):
+		}
+	}
+
+	if !d.opts.DryRun {
+		if err := d.waitDeleted(ctx, pod); err != nil {
+			send(DrainFailed, "evicted but not deleted: "+err.Error())
+			return false
+		}
+	}
+	send(DrainEvicted, "")
+	return true
+}
+
+// waitDeleted polls until the pod is gone or replaced by one with the same
+// name (StatefulSets reuse pod names).
+func (d *drainer) waitDeleted(ctx context.Context, pod *v1.Pod) error {
+	pods := d.cl.Clientset.CoreV1().Pods(pod.Namespace)
+	for {
+		cur, err := pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && cur.UID != pod.UID) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(podDeletePollInterval):
+		}
+	}
+}
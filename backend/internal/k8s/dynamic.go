@@ -0,0 +1,342 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// discoveryTTL bounds how long discovered API types and CRD printer columns
+// are reused before the API server is asked again.
+const discoveryTTL = 5 * time.Minute
+
+var crdGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// APIResourceType is one listable API type as reported by /api/resources/types.
+type APIResourceType struct {
+	Key        string          `json:"key"`
+	Label      string          `json:"label"`
+	Group      string          `json:"group"`
+	Version    string          `json:"version"`
+	Resource   string          `json:"resource"`
+	Kind       string          `json:"kind"`
+	Namespaced bool            `json:"namespaced"`
+	Builtin    bool            `json:"builtin"`
+	Columns    []PrinterColumn `json:"columns,omitempty"`
+}
+
+// GVR returns the type's GroupVersionResource.
+func (t APIResourceType) GVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: t.Group, Version: t.Version, Resource: t.Resource}
+}
+
+// PrinterColumn is a CRD additionalPrinterColumn. Key is the ResourceRow
+// status key the column's value is stored under: the camelCased name with
+// printerColumnPrefix, so columns can't overwrite "kind" or each other.
+type PrinterColumn struct {
+	Name        string `json:"name"`
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	JSONPath    string `json:"jsonPath"`
+	Description string `json:"description,omitempty"`
+}
+
+// discoveryCache holds one cluster's discovered types and CRD columns.
+type discoveryCache struct {
+	mu      sync.Mutex
+	fetched time.Time
+	types   []APIResourceType
+	byKey   map[string]APIResourceType
+}
+
+// ListResourceTypes returns every listable resource the cluster exposes, at
+// its preferred version, sorted by API group (core first). Built-in types
+// keep their short keys ("pods"); everything else is keyed "resource.group".
+func ListResourceTypes(ctx context.Context, cl *Cluster) ([]APIResourceType, error) {
+	dc := cl.discovery()
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if dc.types != nil && time.Since(dc.fetched) < discoveryTTL {
+		return dc.types, nil
+	}
+
+	lists, err := cl.Clientset.Discovery().ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	// A failing aggregated API (e.g. metrics-server down) only hides its own group.
+	if err != nil {
+		log.Printf("partial API discovery for cluster %s: %v", cl.Name, err)
+	}
+
+	builtinKeys := map[schema.GroupVersionResource]string{}
+	for key, gvr := range resourceGVRs {
+		builtinKeys[gvr] = key
+	}
+	columns := crdPrinterColumns(ctx, cl)
+
+	var types []APIResourceType
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") || !hasVerb(r.Verbs, "list") {
+				continue
+			}
+
+			t := APIResourceType{
+				Key:        r.Name,
+				Label:      r.Kind,
+				Group:      gv.Group,
+				Version:    gv.Version,
+				Resource:   r.Name,
+				Kind:       r.Kind,
+				Namespaced: r.Namespaced,
+			}
+			if gv.Group != "" {
+				t.Key = r.Name + "." + gv.Group
+			}
+			if key, ok := builtinKeys[t.GVR()]; ok {
+				t.Key = key
+				t.Builtin = true
+			}
+			t.Columns = columns[t.Resource+"."+t.Group+"/"+t.Version]
+			types = append(types, t)
+		}
+	}
+
+	// Don't cache a result whose CRD lookup was cut short by the caller.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Group != types[j].Group {
+			return types[i].Group < types[j].Group
+		}
+		return types[i].Resource < types[j].Resource
+	})
+
+	dc.types = types
+	dc.byKey = make(map[string]APIResourceType, len(types))
+	for _, t := range types {
+		dc.byKey[t.Key] = t
+	}
+	dc.fetched = time.Now()
+	return types, nil
+}
+
+// LookupResourceType resolves a type key from /api/resources/types. Unknown
+// keys are a BadRequest.
+func LookupResourceType(ctx context.Context, cl *Cluster, key string) (APIResourceType, error) {
+	if _, err := ListResourceTypes(ctx, cl); err != nil {
+		return APIResourceType{}, err
+	}
+
+	dc := cl.discovery()
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	t, ok := dc.byKey[key]
+	if !ok {
+		return APIResourceType{}, apierrors.NewBadRequest("unsupported resource type: " + key)
+	}
+	return t, nil
+}
+
+// RequiresNamespace reports whether listing rtype needs a namespace.
+// Unknown types report false and fail later in ListResources.
+func RequiresNamespace(ctx context.Context, cl *Cluster, rtype string) bool {
+	rtype = strings.ToLower(rtype)
+	if _, ok := resourceGVRs[rtype]; ok {
+		return rtype != "nodes"
+	}
+	t, err := LookupResourceType(ctx, cl, rtype)
+	return err == nil && t.Namespaced
+}
+
+func (cl *Cluster) discovery() *discoveryCache {
+	cl.discoveryOnce.Do(func() {
+		cl.discoveryCache = &discoveryCache{}
+	})
+	return cl.discoveryCache
+}
+
+// listDynamic lists any discovered type through the dynamic client and turns
+// the objects into generic rows.
+func listDynamic(ctx context.Context, cl *Cluster, namespace string, t APIResourceType) ([]ResourceRow, error) {
+	ri := cl.Dynamic.Resource(t.GVR())
+
+	var list *unstructured.UnstructuredList
+	var err error
+	if t.Namespaced && namespace != "" {
+		list, err = ri.Namespace(namespace).List(ctx, metav1.ListOptions{})
+	} else {
+		list, err = ri.List(ctx, metav1.ListOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ResourceRow, 0, len(list.Items))
+	for i := range list.Items {
+		out = append(out, unstructuredRow(&list.Items[i], t.Columns))
+	}
+	return out, nil
+}
+
+// unstructuredRow builds a row from printer columns when the type has them,
+// and otherwise from the status fields most types share.
+func unstructuredRow(obj *unstructured.Unstructured, columns []PrinterColumn) ResourceRow {
+	status := map[string]any{"kind": obj.GetKind()}
+
+	if len(columns) > 0 {
+		for _, col := range columns {
+			status[col.Key] = evalJSONPath(obj.Object, col.JSONPath)
+		}
+	} else {
+		if phase, ok, _ := unstructured.NestedString(obj.Object, "status", "phase"); ok {
+			status["phase"] = phase
+		}
+		if conds, ok, _ := unstructured.NestedSlice(obj.Object, "status", "conditions"); ok {
+			for _, c := range conds {
+				cond, _ := c.(map[string]any)
+				if cond["type"] == "Ready" {
+					status["ready"] = cond["status"]
+				}
+			}
+		}
+	}
+
+	return ResourceRow{
+		Name:              obj.GetName(),
+		Namespace:         obj.GetNamespace(),
+		CreationTimestamp: obj.GetCreationTimestamp().Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            obj.GetLabels(),
+		Status:            status,
+	}
+}
+
+// crdPrinterColumns maps "resource.group/version" to the CRD's priority-0
+// additionalPrinterColumns. Age is dropped since every row already carries
+// creationTimestamp. Errors (e.g. no RBAC on CRDs) just mean no columns.
+func crdPrinterColumns(ctx context.Context, cl *Cluster) map[string][]PrinterColumn {
+	out := map[string][]PrinterColumn{}
+
+	list, err := cl.Dynamic.Resource(crdGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("cannot list CRDs for printer columns (cluster %s): %v", cl.Name, err)
+		return out
+	}
+
+	for _, crd := range list.Items {
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+		versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+
+		for _, v := range versions {
+			ver, _ := v.(map[string]any)
+			name, _ := ver["name"].(string)
+			cols, _ := ver["additionalPrinterColumns"].([]any)
+
+			var columns []PrinterColumn
+			keys := map[string]bool{}
+			for _, c := range cols {
+				col, _ := c.(map[string]any)
+				pc := PrinterColumn{}
+				pc.Name, _ = col["name"].(string)
+				pc.Type, _ = col["type"].(string)
+				pc.JSONPath, _ = col["jsonPath"].(string)
+				pc.Description, _ = col["description"].(string)
+				priority, _ := col["priority"].(int64)
+
+				if priority > 0 || pc.JSONPath == ".metadata.creationTimestamp" {
+					continue
+				}
+				pc.Key = printerColumnPrefix + columnKey(pc.Name)
+				for i := 2; keys[pc.Key]; i++ {
+					pc.Key = printerColumnPrefix + columnKey(pc.Name) + strconv.Itoa(i)
+				}
+				keys[pc.Key] = true
+				columns = append(columns, pc)
+			}
+			if len(columns) > 0 {
+				out[plural+"."+group+"/"+name] = columns
+			}
+		}
+	}
+	return out
+}
+
+// evalJSONPath evaluates a CRD column path such as ".status.conditions[?(@.type=="Ready")].status".
+// Multiple results are joined with commas, like kubectl does.
+func evalJSONPath(obj map[string]any, path string) any {
+	jp := jsonpath.New("column").AllowMissingKeys(true)
+	if err := jp.Parse(fmt.Sprintf("{%s}", path)); err != nil {
+		return nil
+	}
+	results, err := jp.FindResults(obj)
+	if err != nil || len(results) == 0 || len(results[0]) == 0 {
+		return nil
+	}
+	if len(results[0]) == 1 {
+		return results[0][0].Interface()
+	}
+
+	parts := make([]string, 0, len(results[0]))
+	for _, r := range results[0] {
+		parts = append(parts, fmt.Sprint(r.Interface()))
+	}
+	return strings.Join(parts, ",")
+}
+
+// printerColumnPrefix starts the status keys of printer columns.
+const printerColumnPrefix = "column."
+
+// columnKey turns a printer column name like "Last Renewal" into the
+// camelCase status key style the other rows use ("lastRenewal").
+func columnKey(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var b strings.Builder
+	for i, w := range words {
+		if strings.ToUpper(w) == w {
+			w = strings.ToLower(w)
+		}
+		r := []rune(w)
+		if i == 0 {
+			r[0] = unicode.ToLower(r[0])
+		} else {
+			r[0] = unicode.ToUpper(r[0])
+		}
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+func hasVerb(verbs []string, verb string) bool {
+	for _, v := range verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
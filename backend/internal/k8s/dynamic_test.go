@@ -0,0 +1,55 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCRDPrinterColumns(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]any{"name": "widgets.example.com"},
+		"spec": map[string]any{
+			"group": "example.com",
+			"names": map[string]any{"plural": "widgets"},
+			"versions": []any{map[string]any{
+				"name": "v1",
+				"additionalPrinterColumns": []any{
+					map[string]any{"name": "Kind", "type": "string", "jsonPath": ".spec.kind"},
+					map[string]any{"name": "Last Renewal", "type": "date", "jsonPath": ".status.renewed"},
+					map[string]any{"name": "READY", "type": "string", "jsonPath": ".status.ready"},
+					map[string]any{"name": "ready", "type": "string", "jsonPath": ".status.readyReplicas"},
+					map[string]any{"name": "Debug", "type": "string", "jsonPath": ".status.debug", "priority": int64(1)},
+					map[string]any{"name": "Age", "type": "date", "jsonPath": ".metadata.creationTimestamp"},
+				},
+			}},
+		},
+	}}
+	cl := fakeCluster(nil, crd)
+
+	cols := crdPrinterColumns(context.Background(), cl)["widgets.example.com/v1"]
+	var keys []string
+	for _, c := range cols {
+		keys = append(keys, c.Key)
+	}
+	want := []string{"column.kind", "column.lastRenewal", "column.ready", "column.ready2"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("keys = %q, want %q", keys, want)
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]any{"name": "a"},
+		"spec":       map[string]any{"kind": "gear"},
+		"status":     map[string]any{"ready": "True", "readyReplicas": int64(2)},
+	}}
+	row := unstructuredRow(obj, cols)
+	if row.Status["kind"] != "Widget" || row.Status["column.kind"] != "gear" || row.Status["column.ready"] != "True" || row.Status["column.ready2"] != int64(2) {
+		t.Errorf("status = %v", row.Status)
+	}
+}
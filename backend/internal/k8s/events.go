@@ -0,0 +1,307 @@
+package k8s
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// EventQuery filters ListEvents. Empty fields match everything; Namespace
+// empty means all namespaces. Kind is matched case-insensitively.
+type EventQuery struct {
+	Namespace string
+	Kind      string
+	Name      string
+	UID       string
+	Type      string
+	Reason    string
+	Since     time.Time
+	Limit     int
+}
+
+// Events are listed in pages of eventListPage; ListEvents keeps the newest
+// eventMaxKept matching events.
+const (
+	eventListPage = 500
+	eventMaxKept  = 20000
+)
+
+// ClusterEvent is one (de-duplicated) event of /api/events, read from
+// events.k8s.io/v1 or core/v1.
+type ClusterEvent struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	UID       string `json:"uid,omitempty"`
+	FieldPath string `json:"fieldPath,omitempty"`
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+	Source    string `json:"source,omitempty"`
+	Count     int32  `json:"count"`
+	FirstSeen string `json:"firstSeen"`
+	LastSeen  string `json:"lastSeen"`
+
+	first, last time.Time
+	dedupeKey   string
+}
+
+// ListEvents returns the events matching q, newest first. Repeats of the same
+// event (same object, type, reason, message and source) are folded into one
+// entry whose Count sums their series/count. It reads events.k8s.io/v1 and
+// falls back to core/v1 on clusters that don't serve it or don't let the
+// user read it. truncated is set when more than eventMaxKept events matched
+// q and the oldest ones were dropped before de-duplication.
+func ListEvents(ctx context.Context, cl *Cluster, q EventQuery) (result []ClusterEvent, truncated bool, err error) {
+	events, truncated, err := listEventsV1(ctx, cl, q)
+	if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+		events, truncated, err = listCoreEvents(ctx, cl, q)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	byKey := map[string]*ClusterEvent{}
+	var out []*ClusterEvent
+	for i := range events {
+		ev := &events[i]
+		if prev := byKey[ev.dedupeKey]; prev != nil {
+			prev.Count += ev.Count
+			if ev.first.Before(prev.first) {
+				prev.first = ev.first
+			}
+			if ev.last.After(prev.last) {
+				prev.last = ev.last
+			}
+			continue
+		}
+		byKey[ev.dedupeKey] = ev
+		out = append(out, ev)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].last.After(out[j].last) })
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+
+	result = make([]ClusterEvent, 0, len(out))
+	for _, ev := range out {
+		if ev.first.IsZero() {
+			ev.first = ev.last
+		}
+		ev.FirstSeen = ev.first.UTC().Format(time.RFC3339)
+		ev.LastSeen = ev.last.UTC().Format(time.RFC3339)
+		result = append(result, *ev)
+	}
+	return result, truncated, nil
+}
+
+// matches applies the filters the API server can't (kind case-insensitively,
+// the time window) and re-checks the rest, since field selector support
+// varies between event APIs.
+func (q EventQuery) matches(ev *ClusterEvent) bool {
+	switch {
+	case q.Kind != "" && !strings.EqualFold(q.Kind, ev.Kind):
+		return false
+	case q.Name != "" && q.Name != ev.Name:
+		return false
+	case q.UID != "" && q.UID != ev.UID:
+		return false
+	case q.Type != "" && q.Type != ev.Type:
+		return false
+	case q.Reason != "" && q.Reason != ev.Reason:
+		return false
+	case !q.Since.IsZero() && ev.last.Before(q.Since):
+		return false
+	}
+	return true
+}
+
+// fieldSelector builds the server-side selector; prefix is "regarding" for
+// events.k8s.io and "involvedObject" for core/v1. Type and reason are only
+// selectable on core/v1.
+func (q EventQuery) fieldSelector(prefix string) string {
+	set := fields.Set{}
+	if q.Name != "" {
+		set[prefix+".name"] = q.Name
+	}
+	if q.UID != "" {
+		set[prefix+".uid"] = q.UID
+	}
+	if prefix == "involvedObject" {
+		if q.Type != "" {
+			set["type"] = q.Type
+		}
+		if q.Reason != "" {
+			set["reason"] = q.Reason
+		}
+	}
+	return set.AsSelector().String()
+}
+
+// listEventPages calls page with opts and the continue token of the
+// previous page until the list ends. The server lists events by name, so
+// every page is read and only the newest eventMaxKept events matching q are
+// kept; truncated reports that older matches were dropped.
+func listEventPages(opts metav1.ListOptions, q EventQuery, page func(metav1.ListOptions) (next string, events []ClusterEvent, err error)) (kept []ClusterEvent, truncated bool, err error) {
+	opts.Limit = eventListPage
+	var newest newestEvents
+	for {
+		next, events, err := page(opts)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, ev := range events {
+			if q.matches(&ev) && !newest.keep(ev) {
+				truncated = true
+			}
+		}
+		if next == "" {
+			return newest, truncated, nil
+		}
+		opts.Continue = next
+	}
+}
+
+// newestEvents is a min-heap by last seen time holding at most eventMaxKept
+// events.
+type newestEvents []ClusterEvent
+
+// keep adds ev, evicting the oldest event when full. It reports false when
+// an event, ev or the evicted one, was dropped.
+func (h *newestEvents) keep(ev ClusterEvent) bool {
+	if len(*h) < eventMaxKept {
+		heap.Push(h, ev)
+		return true
+	}
+	if ev.last.After((*h)[0].last) {
+		(*h)[0] = ev
+		heap.Fix(h, 0)
+	}
+	return false
+}
+
+func (h newestEvents) Len() int           { return len(h) }
+func (h newestEvents) Less(i, j int) bool { return h[i].last.Before(h[j].last) }
+func (h newestEvents) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *newestEvents) Push(x any)        { *h = append(*h, x.(ClusterEvent)) }
+func (h *newestEvents) Pop() any {
+	old := *h
+	ev := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return ev
+}
+
+func listEventsV1(ctx context.Context, cl *Cluster, q EventQuery) ([]ClusterEvent, bool, error) {
+	return listEventPages(metav1.ListOptions{FieldSelector: q.fieldSelector("regarding")}, q, func(opts metav1.ListOptions) (string, []ClusterEvent, error) {
+		list, err := cl.Clientset.EventsV1().Events(q.Namespace).List(ctx, opts)
+		if err != nil {
+			return "", nil, err
+		}
+		events := make([]ClusterEvent, 0, len(list.Items))
+		for _, ev := range list.Items {
+			events = append(events, eventV1(ev))
+		}
+		return list.Continue, events, nil
+	})
+}
+
+func eventV1(ev eventsv1.Event) ClusterEvent {
+	ce := ClusterEvent{
+		Namespace: ev.Namespace,
+		Kind:      ev.Regarding.Kind,
+		Name:      ev.Regarding.Name,
+		UID:       string(ev.Regarding.UID),
+		FieldPath: ev.Regarding.FieldPath,
+		Type:      ev.Type,
+		Reason:    ev.Reason,
+		Message:   ev.Note,
+		Source:    firstNonEmpty(ev.ReportingController, ev.DeprecatedSource.Component),
+		Count:     1,
+	}
+	if ce.Namespace == "" {
+		ce.Namespace = ev.Regarding.Namespace
+	}
+	ce.first = firstTime(ev.DeprecatedFirstTimestamp.Time, ev.EventTime.Time, ev.CreationTimestamp.Time)
+	ce.last = firstTime(ev.DeprecatedLastTimestamp.Time, ev.EventTime.Time, ev.CreationTimestamp.Time)
+	if ev.DeprecatedCount > 0 {
+		ce.Count = ev.DeprecatedCount
+	}
+	if s := ev.Series; s != nil {
+		ce.Count = s.Count
+		ce.last = latest(ce.last, s.LastObservedTime.Time)
+	}
+	ce.setKey()
+	return ce
+}
+
+func listCoreEvents(ctx context.Context, cl *Cluster, q EventQuery) ([]ClusterEvent, bool, error) {
+	return listEventPages(metav1.ListOptions{FieldSelector: q.fieldSelector("involvedObject")}, q, func(opts metav1.ListOptions) (string, []ClusterEvent, error) {
+		list, err := cl.Clientset.CoreV1().Events(q.Namespace).List(ctx, opts)
+		if err != nil {
+			return "", nil, err
+		}
+		events := make([]ClusterEvent, 0, len(list.Items))
+		for _, ev := range list.Items {
+			events = append(events, coreEvent(ev))
+		}
+		return list.Continue, events, nil
+	})
+}
+
+func coreEvent(ev v1.Event) ClusterEvent {
+	ce := ClusterEvent{
+		Namespace: ev.Namespace,
+		Kind:      ev.InvolvedObject.Kind,
+		Name:      ev.InvolvedObject.Name,
+		UID:       string(ev.InvolvedObject.UID),
+		FieldPath: ev.InvolvedObject.FieldPath,
+		Type:      ev.Type,
+		Reason:    ev.Reason,
+		Message:   ev.Message,
+		Source:    firstNonEmpty(ev.ReportingController, ev.Source.Component),
+		Count:     1,
+	}
+	ce.first = firstTime(ev.FirstTimestamp.Time, ev.EventTime.Time, ev.CreationTimestamp.Time)
+	ce.last = firstTime(ev.LastTimestamp.Time, ev.EventTime.Time, ev.CreationTimestamp.Time)
+	if ev.Count > 0 {
+		ce.Count = ev.Count
+	}
+	if s := ev.Series; s != nil {
+		ce.Count = s.Count
+		ce.last = latest(ce.last, s.LastObservedTime.Time)
+	}
+	ce.setKey()
+	return ce
+}
+
+// setKey identifies repeats of the same occurrence. Recorders normally fold
+// repeats into one object's series/count, but after a count reset or with
+// several recorder instances the same event exists as separate objects.
+func (ev *ClusterEvent) setKey() {
+	ev.dedupeKey = strings.Join([]string{ev.Namespace, ev.Kind, ev.Name, ev.UID, ev.FieldPath, ev.Type, ev.Reason, ev.Message, ev.Source}, "\x00")
+}
+
+func firstTime(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,171 @@
+package k8s
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var eventBase = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func testEventV1(name, pod, reason, note string, count int32, first, last time.Duration) *eventsv1.Event {
+	return &eventsv1.Event{
+		ObjectMeta:               metav1.ObjectMeta{Namespace: "shop", Name: name},
+		Regarding:                v1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: pod},
+		Type:                     v1.EventTypeWarning,
+		Reason:                   reason,
+		Note:                     note,
+		ReportingController:      "kubelet",
+		DeprecatedCount:          count,
+		DeprecatedFirstTimestamp: metav1.NewTime(eventBase.Add(first)),
+		DeprecatedLastTimestamp:  metav1.NewTime(eventBase.Add(last)),
+	}
+}
+
+func TestListEventsDedupe(t *testing.T) {
+	cl := fakeCluster(nil,
+		// Two objects for the same occurrence, e.g. after a count reset.
+		testEventV1("a.1", "web", "BackOff", "restarting", 3, 0, 10*time.Minute),
+		testEventV1("a.2", "web", "BackOff", "restarting", 2, 20*time.Minute, 30*time.Minute),
+		testEventV1("b", "web", "Unhealthy", "probe failed", 1, 5*time.Minute, 5*time.Minute),
+		testEventV1("c", "db", "BackOff", "restarting", 4, 0, 15*time.Minute),
+	)
+
+	events, truncated, err := ListEvents(context.Background(), cl, EventQuery{Namespace: "shop"})
+	if err != nil || truncated {
+		t.Fatalf("ListEvents: %v (truncated %v)", err, truncated)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %+v, want 3", events)
+	}
+	// Newest first: the merged web BackOff, db, then Unhealthy.
+	merged := events[0]
+	if merged.Name != "web" || merged.Reason != "BackOff" || merged.Count != 5 ||
+		merged.FirstSeen != "2024-05-01T10:00:00Z" || merged.LastSeen != "2024-05-01T10:30:00Z" {
+		t.Errorf("merged = %+v", merged)
+	}
+	if events[1].Name != "db" || events[2].Reason != "Unhealthy" {
+		t.Errorf("order = %s, %s", events[1].Name, events[2].Reason)
+	}
+
+	events, _, _ = ListEvents(context.Background(), cl, EventQuery{Namespace: "shop", Kind: "pod", Reason: "BackOff", Limit: 1})
+	if len(events) != 1 || events[0].Count != 5 {
+		t.Errorf("limited = %+v", events)
+	}
+}
+
+func TestListEventsFallsBackToCore(t *testing.T) {
+	for _, apiErr := range []error{
+		apierrors.NewNotFound(schema.GroupResource{Group: "events.k8s.io", Resource: "events"}, ""),
+		apierrors.NewForbidden(schema.GroupResource{Group: "events.k8s.io", Resource: "events"}, "", nil),
+	} {
+		cl := fakeCluster(nil, &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "shop", Name: "core"},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "web"},
+			Type:           v1.EventTypeNormal,
+			Reason:         "Pulled",
+			LastTimestamp:  metav1.NewTime(eventBase),
+		})
+		cl.Clientset.(*fake.Clientset).PrependReactor("list", "events", func(a k8stesting.Action) (bool, runtime.Object, error) {
+			return a.GetResource().Group == "events.k8s.io", nil, apiErr
+		})
+
+		events, _, err := ListEvents(context.Background(), cl, EventQuery{Namespace: "shop"})
+		if err != nil || len(events) != 1 || events[0].Reason != "Pulled" || events[0].Count != 1 {
+			t.Errorf("%v: events = %+v, err %v", apiErr, events, err)
+		}
+	}
+}
+
+func TestListEventPages(t *testing.T) {
+	var pages []string
+	// Event i was last seen i seconds after eventBase, so the newest events
+	// come last in list order; every other one is a Warning.
+	page := func(total int) func(metav1.ListOptions) (string, []ClusterEvent, error) {
+		return func(opts metav1.ListOptions) (string, []ClusterEvent, error) {
+			pages = append(pages, opts.Continue)
+			if opts.Limit != eventListPage {
+				t.Errorf("limit = %d", opts.Limit)
+			}
+			start, _ := strconv.Atoi(opts.Continue)
+			n := min(eventListPage, total-start)
+			events := make([]ClusterEvent, n)
+			for i := range events {
+				events[i].Type = v1.EventTypeNormal
+				if (start+i)%2 == 0 {
+					events[i].Type = v1.EventTypeWarning
+				}
+				events[i].last = eventBase.Add(time.Duration(start+i) * time.Second)
+			}
+			if start+n == total {
+				return "", events, nil
+			}
+			return strconv.Itoa(start + n), events, nil
+		}
+	}
+
+	events, truncated, err := listEventPages(metav1.ListOptions{}, EventQuery{}, page(1200))
+	if err != nil || truncated || len(events) != 1200 || len(pages) != 3 || pages[2] != "1000" {
+		t.Errorf("1200 events: %d kept, pages %q, truncated %v, err %v", len(events), pages, truncated, err)
+	}
+
+	// Filtered-out events don't count towards the cap.
+	pages = nil
+	events, truncated, _ = listEventPages(metav1.ListOptions{}, EventQuery{Type: v1.EventTypeWarning}, page(eventMaxKept*2))
+	if truncated || len(events) != eventMaxKept {
+		t.Errorf("%d warnings kept, truncated %v", len(events), truncated)
+	}
+
+	// Past the cap the oldest matches are dropped, wherever they are listed.
+	pages = nil
+	total := eventMaxKept*2 + 1000
+	events, truncated, _ = listEventPages(metav1.ListOptions{}, EventQuery{Type: v1.EventTypeWarning}, page(total))
+	if !truncated || len(events) != eventMaxKept || len(pages) != (total+eventListPage-1)/eventListPage {
+		t.Fatalf("too many events: %d kept from %d pages, truncated %v", len(events), len(pages), truncated)
+	}
+	oldest := events[0].last
+	for _, ev := range events {
+		if ev.Type != v1.EventTypeWarning {
+			t.Fatalf("kept a %s event", ev.Type)
+		}
+		if ev.last.Before(oldest) {
+			oldest = ev.last
+		}
+	}
+	if want := eventBase.Add(1000 * time.Second); !oldest.Equal(want) {
+		t.Errorf("oldest kept = %v, want %v", oldest, want)
+	}
+}
+
+func TestEventQueryMatches(t *testing.T) {
+	ev := &ClusterEvent{Kind: "Pod", Name: "web", UID: "u1", Type: v1.EventTypeWarning, Reason: "BackOff", last: eventBase}
+	tests := []struct {
+		q    EventQuery
+		want bool
+	}{
+		{EventQuery{}, true},
+		{EventQuery{Kind: "pod", Name: "web", UID: "u1", Type: v1.EventTypeWarning, Reason: "BackOff"}, true},
+		{EventQuery{Kind: "Deployment"}, false},
+		{EventQuery{Name: "db"}, false},
+		{EventQuery{UID: "u2"}, false},
+		{EventQuery{Type: v1.EventTypeNormal}, false},
+		{EventQuery{Reason: "Pulled"}, false},
+		{EventQuery{Since: eventBase}, true},
+		{EventQuery{Since: eventBase.Add(time.Second)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.q.matches(ev); got != tt.want {
+			t.Errorf("%+v matches = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
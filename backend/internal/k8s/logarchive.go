@@ -0,0 +1,343 @@
+package k8s
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Log archive formats.
+const (
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// ArchiveOptions configures WriteLogArchive.
+type ArchiveOptions struct {
+	Format string
+	// Previous adds the log of each container's previous instance.
+	Previous bool
+	// Describe adds a describe.json summary per pod.
+	Describe bool
+	// MaxBytes caps the total log bytes in the archive, shared across the
+	// logs; zero means no cap.
+	MaxBytes int64
+}
+
+// PodSummary is the describe.json of a pod in a log archive.
+type PodSummary struct {
+	Name       string               `json:"name"`
+	Namespace  string               `json:"namespace"`
+	Node       string               `json:"node"`
+	Phase      string               `json:"phase"`
+	PodIP      string               `json:"podIP,omitempty"`
+	StartTime  string               `json:"startTime,omitempty"`
+	Labels     map[string]string    `json:"labels,omitempty"`
+	Owners     []string             `json:"owners,omitempty"`
+	Conditions []v1.PodCondition    `json:"conditions"`
+	Containers []v1.ContainerStatus `json:"containers"`
+	Events     []EventSummary       `json:"events"`
+}
+
+// EventSummary is one event in a PodSummary.
+type EventSummary struct {
+	Type     string `json:"type"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+	Count    int32  `json:"count"`
+	LastSeen string `json:"lastSeen"`
+}
+
+// archiveWriter adds files of known size to a tar.gz or zip stream.
+type archiveWriter interface {
+	add(name string, size int64, r io.Reader) error
+	Close() error
+}
+
+// WriteLogArchive writes an archive with one file per pod container to w,
+// named "<pod>/<container>.log" (and ".previous.log" for containers that
+// have a previous instance), plus optional describe.json summaries. Logs are
+// spooled to temp files one at a time, so memory use doesn't grow with the
+// archive. MaxBytes is shared out across the logs: each gets an equal part of
+// what the logs before it left unused, and a longer log keeps only its newest
+// lines, listed in TRUNCATED.txt. Logs that can't be read are listed in
+// errors.txt.
+func WriteLogArchive(ctx context.Context, cl *Cluster, w io.Writer, pods []v1.Pod, opts ArchiveOptions) error {
+	var aw archiveWriter
+	switch opts.Format {
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		aw = &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}
+	case ArchiveZip:
+		aw = &zipWriter{zw: zip.NewWriter(w)}
+	default:
+		return fmt.Errorf("unsupported archive format %q", opts.Format)
+	}
+
+	logsLeft := 0
+	for i := range pods {
+		logsLeft += len(podLogFiles(&pods[i], opts.Previous))
+	}
+
+	var problems, truncated []string
+	remaining := opts.MaxBytes
+
+	for i := range pods {
+		pod := &pods[i]
+		if opts.Describe {
+			data, err := json.MarshalIndent(describePod(ctx, cl, pod), "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := aw.add(path.Join(pod.Name, "describe.json"), int64(len(data)), strings.NewReader(string(data))); err != nil {
+				return err
+			}
+		}
+
+		for _, lf := range podLogFiles(pod, opts.Previous) {
+			var budget int64
+			if opts.MaxBytes > 0 {
+				budget = max(remaining/int64(logsLeft), 1)
+			}
+			logsLeft--
+
+			n, cut, err := addPodLog(ctx, cl, aw, pod, lf.name, lf.opts, budget)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				problems = append(problems, fmt.Sprintf("%s: %v", lf.name, err))
+				continue
+			}
+			remaining -= n
+			if cut {
+				truncated = append(truncated, lf.name)
+			}
+		}
+	}
+
+	if len(truncated) > 0 {
+		msg := fmt.Sprintf("The archive is capped at %d bytes of logs, shared across its logs. "+
+			"These logs were cut to their newest lines:\n%s\n", opts.MaxBytes, strings.Join(truncated, "\n"))
+		if err := aw.add("TRUNCATED.txt", int64(len(msg)), strings.NewReader(msg)); err != nil {
+			return err
+		}
+	}
+	if len(problems) > 0 {
+		msg := strings.Join(problems, "\n") + "\n"
+		if err := aw.add("errors.txt", int64(len(msg)), strings.NewReader(msg)); err != nil {
+			return err
+		}
+	}
+	return aw.Close()
+}
+
+// logFile is one container log of an archive.
+type logFile struct {
+	name string
+	opts *v1.PodLogOptions
+}
+
+// podLogFiles lists the logs of a pod's init and app containers. Previous
+// logs are only included for containers whose status shows an earlier
+// instance, since asking for one that doesn't exist is an error.
+func podLogFiles(pod *v1.Pod, previous bool) []logFile {
+	hasPrevious := map[string]bool{}
+	for _, st := range append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		hasPrevious[st.Name] = st.RestartCount > 0 || st.LastTerminationState.Terminated != nil
+	}
+
+	var out []logFile
+	for _, ct := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		out = append(out, logFile{
+			name: path.Join(pod.Name, ct.Name+".log"),
+			opts: &v1.PodLogOptions{Container: ct.Name},
+		})
+		if previous && hasPrevious[ct.Name] {
+			out = append(out, logFile{
+				name: path.Join(pod.Name, ct.Name+".previous.log"),
+				opts: &v1.PodLogOptions{Container: ct.Name, Previous: true},
+			})
+		}
+	}
+	return out
+}
+
+// addPodLog spools one container log to a temp file and adds it to the
+// archive, returning the size added. With a budget only the last budget
+// bytes are kept, starting at a line boundary, and cut reports that the log
+// was longer.
+func addPodLog(ctx context.Context, cl *Cluster, aw archiveWriter, pod *v1.Pod, name string, opts *v1.PodLogOptions, budget int64) (n int64, cut bool, err error) {
+	rc, err := cl.Clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "webk8s-log-*")
+	if err != nil {
+		return 0, false, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	tail := &tailFile{f: tmp, max: budget}
+	if _, err := io.Copy(tail, rc); err != nil {
+		return 0, false, err
+	}
+	r, n, cut, err := tail.reader()
+	if err != nil {
+		return 0, false, err
+	}
+	return n, cut, aw.add(name, n, r)
+}
+
+// tailFile writes into f as a ring buffer of max bytes (unbounded when max
+// is 0), so it holds the last max bytes written.
+type tailFile struct {
+	f       *os.File
+	max     int64
+	written int64
+}
+
+func (t *tailFile) Write(p []byte) (int, error) {
+	n := len(p)
+	if t.max <= 0 {
+		_, err := t.f.WriteAt(p, t.written)
+		t.written += int64(n)
+		return n, err
+	}
+
+	// Only the end of a write longer than the buffer can survive.
+	if int64(len(p)) > t.max {
+		t.written += int64(len(p)) - t.max
+		p = p[int64(len(p))-t.max:]
+	}
+	for len(p) > 0 {
+		off := t.written % t.max
+		chunk := p[:min(int64(len(p)), t.max-off)]
+		if _, err := t.f.WriteAt(chunk, off); err != nil {
+			return 0, err
+		}
+		t.written += int64(len(chunk))
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// reader returns the kept bytes in order and their size. When older bytes
+// were overwritten, the possibly partial line at the start is dropped too,
+// unless it is all that was kept.
+func (t *tailFile) reader() (io.Reader, int64, bool, error) {
+	if t.max <= 0 || t.written <= t.max {
+		return io.NewSectionReader(t.f, 0, t.written), t.written, false, nil
+	}
+
+	start := t.written % t.max
+	ordered := func() io.Reader {
+		return io.MultiReader(io.NewSectionReader(t.f, start, t.max-start), io.NewSectionReader(t.f, 0, start))
+	}
+
+	br := bufio.NewReader(ordered())
+	partial, err := br.ReadString('\n')
+	switch {
+	case err == io.EOF || int64(len(partial)) == t.max:
+		return ordered(), t.max, true, nil
+	case err != nil:
+		return nil, 0, false, err
+	}
+	return br, t.max - int64(len(partial)), true, nil
+}
+
+// describePod summarizes a pod like `kubectl describe`. Events that can't be
+// listed are left out rather than failing the archive.
+func describePod(ctx context.Context, cl *Cluster, pod *v1.Pod) PodSummary {
+	s := PodSummary{
+		Name:       pod.Name,
+		Namespace:  pod.Namespace,
+		Node:       pod.Spec.NodeName,
+		Phase:      string(pod.Status.Phase),
+		PodIP:      pod.Status.PodIP,
+		Labels:     pod.Labels,
+		Conditions: pod.Status.Conditions,
+		Containers: append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...),
+		Events:     []EventSummary{},
+	}
+	if pod.Status.StartTime != nil {
+		s.StartTime = pod.Status.StartTime.Time.Format("2006-01-02T15:04:05Z")
+	}
+	for _, ref := range pod.OwnerReferences {
+		s.Owners = append(s.Owners, ref.Kind+"/"+ref.Name)
+	}
+
+	events, err := cl.Clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + pod.Name,
+	})
+	if err != nil {
+		return s
+	}
+	for _, ev := range events.Items {
+		last := ev.LastTimestamp.Time
+		if last.IsZero() {
+			last = ev.EventTime.Time
+		}
+		s.Events = append(s.Events, EventSummary{
+			Type:     ev.Type,
+			Reason:   ev.Reason,
+			Message:  ev.Message,
+			Count:    ev.Count,
+			LastSeen: last.Format("2006-01-02T15:04:05Z"),
+		})
+	}
+	return s
+}
+
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarGzWriter) add(name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: time.Now()}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.CopyN(t.tw, r, size)
+	return err
+}
+
+func (t *tarGzWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) add(name string, _ int64, r io.Reader) error {
+	f, err := z.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
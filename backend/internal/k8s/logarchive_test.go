@@ -0,0 +1,145 @@
+package k8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTailFile(t *testing.T) {
+	const log = "line1\nline2\nline3\n"
+
+	tests := []struct {
+		max     int64
+		want    string
+		wantCut bool
+	}{
+		{0, log, false},
+		{18, log, false},
+		{100, log, false},
+		{10, "line3\n", true},        // "ne2\nline3\n" without its partial line
+		{12, "line3\n", true},        // "line2\n" might be partial, so it goes too
+		{13, "line2\nline3\n", true}, // "\nline2\nline3\n"
+		{4, "ne3\n", true},           // a line longer than the budget is kept cut
+		{3, "e3\n", true},
+		{17, "line2\nline3\n", true},
+	}
+	for _, tt := range tests {
+		for _, chunk := range []int{1, 4, 7, len(log)} {
+			tmp, err := os.CreateTemp(t.TempDir(), "tail")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tail := &tailFile{f: tmp, max: tt.max}
+			for i := 0; i < len(log); i += chunk {
+				if _, err := tail.Write([]byte(log[i:min(i+chunk, len(log))])); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r, n, cut, err := tail.reader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(r)
+			if string(got) != tt.want || n != int64(len(got)) || cut != tt.wantCut {
+				t.Errorf("max=%d chunk=%d: got %q (size %d, cut %v), want %q (cut %v)",
+					tt.max, chunk, got, n, cut, tt.want, tt.wantCut)
+			}
+			tmp.Close()
+		}
+	}
+}
+
+func TestPodLogFiles(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1"},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "init"}},
+			Containers:     []v1.Container{{Name: "app"}, {Name: "sidecar"}},
+		},
+		Status: v1.PodStatus{
+			InitContainerStatuses: []v1.ContainerStatus{{Name: "init"}},
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "app", RestartCount: 2},
+				{Name: "sidecar"},
+			},
+		},
+	}
+
+	names := func(files []logFile) []string {
+		var out []string
+		for _, f := range files {
+			out = append(out, f.name)
+		}
+		return out
+	}
+	if got, want := names(podLogFiles(pod, false)), []string{"web-1/init.log", "web-1/app.log", "web-1/sidecar.log"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without previous = %v, want %v", got, want)
+	}
+	if got, want := names(podLogFiles(pod, true)), []string{"web-1/init.log", "web-1/app.log", "web-1/app.previous.log", "web-1/sidecar.log"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with previous = %v, want %v", got, want)
+	}
+}
+
+func TestWriteLogArchiveSharesBudget(t *testing.T) {
+	// The fake clientset returns "fake logs" for every container.
+	pods := []v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "shop"}, Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "proxy"}}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "shop"}, Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}}}},
+	}
+	cl := fakeCluster(nil, &pods[0], &pods[1])
+
+	var buf bytes.Buffer
+	err := WriteLogArchive(context.Background(), cl, &buf, pods, ArchiveOptions{Format: ArchiveTarGz, MaxBytes: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := readTarGz(t, &buf)
+	// 25 bytes over three logs: 8, then 17/2 = 8, then the 9 left, enough
+	// for the whole last log.
+	want := map[string]string{"a/app.log": "ake logs", "a/proxy.log": "ake logs", "b/app.log": "fake logs"}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s = %q, want %q", name, files[name], content)
+		}
+	}
+	if !strings.Contains(files["TRUNCATED.txt"], "a/app.log\na/proxy.log\n") || strings.Contains(files["TRUNCATED.txt"], "b/app.log") {
+		t.Errorf("TRUNCATED.txt = %q", files["TRUNCATED.txt"])
+	}
+	if _, ok := files["errors.txt"]; ok {
+		t.Errorf("unexpected errors.txt: %q", files["errors.txt"])
+	}
+}
+
+func readTarGz(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(tr)
+		files[hdr.Name] = string(b)
+	}
+	return files
+}
@@ -0,0 +1,166 @@
+package k8s
+
+import (
+	"context"
+	"regexp"
+	"unicode/utf8"
+)
+
+// MaxLogContext bounds the context lines a filter may keep per container.
+const MaxLogContext = 100
+
+// LogFilter selects log lines server-side, like grep: lines must match
+// Include (when set) and must not match Exclude. Before and After add that
+// many surrounding lines of context around each match, per container.
+type LogFilter struct {
+	Include *regexp.Regexp
+	Exclude *regexp.Regexp
+	Before  int
+	After   int
+}
+
+// NewLogFilter compiles a filter. It returns nil when include and exclude are
+// both empty, meaning every line passes.
+func NewLogFilter(include, exclude string, ignoreCase bool, before, after int) (*LogFilter, error) {
+	if include == "" && exclude == "" {
+		return nil, nil
+	}
+
+	prefix := ""
+	if ignoreCase {
+		prefix = "(?i)"
+	}
+	f := &LogFilter{Before: before, After: after}
+	var err error
+	if include != "" {
+		if f.Include, err = regexp.Compile(prefix + include); err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		if f.Exclude, err = regexp.Compile(prefix + exclude); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Apply filters a finished list of lines.
+func (f *LogFilter) Apply(lines []LogEvent) []LogEvent {
+	if f == nil {
+		return lines
+	}
+	st := newLogFilterState(f)
+	out := []LogEvent{}
+	for _, ev := range lines {
+		out = append(out, st.process(ev)...)
+	}
+	return out
+}
+
+// FilterLogEvents applies f to a log stream. Events other than lines pass
+// through unchanged. The returned channel closes when in does.
+func FilterLogEvents(ctx context.Context, in <-chan LogEvent, f *LogFilter) <-chan LogEvent {
+	if f == nil {
+		return in
+	}
+	return pipeLogEvents(ctx, in, newLogFilterState(f).process)
+}
+
+// pipeLogEvents runs one stage of the log pipeline: every event read from in
+// is replaced by what fn returns for it. The returned channel closes when in
+// does.
+func pipeLogEvents(ctx context.Context, in <-chan LogEvent, fn func(LogEvent) []LogEvent) <-chan LogEvent {
+	out := make(chan LogEvent, 64)
+	go func() {
+		defer close(out)
+		for ev := range in {
+			for _, e := range fn(ev) {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// logFilterState keeps the context window of each container separately, so
+// the lines of an aggregated stream don't act as each other's context.
+type logFilterState struct {
+	f          *LogFilter
+	containers map[string]*containerContext
+}
+
+type containerContext struct {
+	before    []LogEvent
+	afterLeft int
+}
+
+func newLogFilterState(f *LogFilter) *logFilterState {
+	return &logFilterState{f: f, containers: map[string]*containerContext{}}
+}
+
+// process returns the events to emit for ev: nothing, ev itself, or ev
+// preceded by the context lines it releases.
+func (st *logFilterState) process(ev LogEvent) []LogEvent {
+	if ev.Type != LogLineEvent {
+		return []LogEvent{ev}
+	}
+
+	key := ev.Pod + "/" + ev.Container
+	cc := st.containers[key]
+	if cc == nil {
+		cc = &containerContext{}
+		st.containers[key] = cc
+	}
+
+	if st.f.Exclude != nil && st.f.Exclude.MatchString(ev.Line) {
+		return nil
+	}
+
+	var matches [][2]int
+	if st.f.Include != nil {
+		locs := st.f.Include.FindAllStringIndex(ev.Line, -1)
+		if locs == nil {
+			return st.contextLine(cc, ev)
+		}
+		matches = runeOffsets(ev.Line, locs)
+	}
+
+	out := cc.before
+	cc.before = nil
+	cc.afterLeft = st.f.After
+	ev.Matches = matches
+	return append(out, ev)
+}
+
+// contextLine handles a line that didn't match: it's emitted as trailing
+// context of an earlier match, or remembered as leading context.
+func (st *logFilterState) contextLine(cc *containerContext, ev LogEvent) []LogEvent {
+	ev.Context = true
+	if cc.afterLeft > 0 {
+		cc.afterLeft--
+		return []LogEvent{ev}
+	}
+	if st.f.Before > 0 {
+		cc.before = append(cc.before, ev)
+		if len(cc.before) > st.f.Before {
+			cc.before = cc.before[1:]
+		}
+	}
+	return nil
+}
+
+// runeOffsets converts regexp byte offsets to character offsets, which is
+// what a UI needs to highlight a match.
+func runeOffsets(line string, locs [][]int) [][2]int {
+	out := make([][2]int, len(locs))
+	for i, loc := range locs {
+		start := utf8.RuneCountInString(line[:loc[0]])
+		out[i] = [2]int{start, start + utf8.RuneCountInString(line[loc[0]:loc[1]])}
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func logLines(container string, lines ...string) []LogEvent {
+	out := make([]LogEvent, len(lines))
+	for i, l := range lines {
+		out[i] = LogEvent{Type: LogLineEvent, Pod: "web-1", Container: container, Line: l}
+	}
+	return out
+}
+
+// describeLines renders lines as "line" for matches and "(line)" for context.
+func describeLines(lines []LogEvent) string {
+	var out []string
+	for _, ev := range lines {
+		s := ev.Line
+		if ev.Context {
+			s = "(" + s + ")"
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestNewLogFilter(t *testing.T) {
+	if f, err := NewLogFilter("", "", true, 3, 3); f != nil || err != nil {
+		t.Errorf("empty patterns = %+v, %v; want nil", f, err)
+	}
+	if _, err := NewLogFilter("(", "", false, 0, 0); err == nil {
+		t.Error("invalid include compiled")
+	}
+	if _, err := NewLogFilter("", "[", false, 0, 0); err == nil {
+		t.Error("invalid exclude compiled")
+	}
+
+	f, err := NewLogFilter("error", "", true, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := describeLines(f.Apply(logLines("app", "ERROR boom", "info ok"))); got != "ERROR boom" {
+		t.Errorf("ignoreCase = %q", got)
+	}
+}
+
+func TestLogFilterApply(t *testing.T) {
+	lines := logLines("app", "a", "b", "ERR 1", "c", "d", "e", "ERR 2", "ERR 3", "f", "g")
+
+	tests := []struct {
+		include, exclude string
+		before, after    int
+		want             string
+	}{
+		{include: "ERR", want: "ERR 1,ERR 2,ERR 3"},
+		{exclude: "ERR|^[a-d]$", want: "e,f,g"},
+		{include: "ERR", exclude: "2", want: "ERR 1,ERR 3"},
+		{include: "ERR", before: 1, want: "(b),ERR 1,(e),ERR 2,ERR 3"},
+		{include: "ERR", after: 1, want: "ERR 1,(c),ERR 2,ERR 3,(f)"},
+		// Context windows don't overlap or repeat lines.
+		{include: "ERR", before: 2, after: 2, want: "(a),(b),ERR 1,(c),(d),(e),ERR 2,ERR 3,(f),(g)"},
+		// Excluded lines aren't context either.
+		{include: "ERR", exclude: "^b$", before: 1, want: "(a),ERR 1,(e),ERR 2,ERR 3"},
+	}
+	for _, tt := range tests {
+		f, err := NewLogFilter(tt.include, tt.exclude, false, tt.before, tt.after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := describeLines(f.Apply(lines)); got != tt.want {
+			t.Errorf("include=%q exclude=%q before=%d after=%d: got %q, want %q",
+				tt.include, tt.exclude, tt.before, tt.after, got, tt.want)
+		}
+	}
+
+	var nilFilter *LogFilter
+	if got := nilFilter.Apply(lines); len(got) != len(lines) {
+		t.Errorf("nil filter kept %d of %d lines", len(got), len(lines))
+	}
+}
+
+func TestLogFilterContextPerContainer(t *testing.T) {
+	app, proxy := logLines("app", "a1", "ERR"), logLines("proxy", "p1", "p2")
+	lines := []LogEvent{app[0], proxy[0], app[1], proxy[1]}
+
+	f, _ := NewLogFilter("ERR", "", false, 1, 1)
+	got := f.Apply(lines)
+	if describeLines(got) != "(a1),ERR" || got[0].Container != "app" {
+		t.Errorf("got %q, want only the app container's context", describeLines(got))
+	}
+}
+
+func TestLogFilterMatchOffsets(t *testing.T) {
+	f, _ := NewLogFilter("fé+l", "", false, 0, 0)
+	got := f.Apply(logLines("app", "ça fééél, fél"))
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Matches, [][2]int{{3, 8}, {10, 13}}) {
+		t.Errorf("matches = %+v", got)
+	}
+}
+
+func TestFilterLogEvents(t *testing.T) {
+	in := make(chan LogEvent, 8)
+	for _, ev := range logLines("app", "ok", "ERR") {
+		in <- ev
+	}
+	in <- LogEvent{Type: LogEndEvent, Pod: "web-1", Container: "app"}
+	close(in)
+
+	f, _ := NewLogFilter("ERR", "", false, 0, 0)
+	var got []string
+	for ev := range FilterLogEvents(context.Background(), in, f) {
+		got = append(got, ev.Type+":"+ev.Line)
+	}
+	if want := []string{"line:ERR", "end:"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,253 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StructuredLog is what the JSON parsing stage extracts from a log line.
+// Fields holds every key that isn't the level, message or time.
+type StructuredLog struct {
+	Level   string         `json:"level,omitempty"`
+	Message string         `json:"msg,omitempty"`
+	Time    string         `json:"time,omitempty"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// Keys the common JSON loggers (zap, logrus, slog, bunyan/pino) use.
+var (
+	levelKeys   = []string{"level", "lvl", "severity"}
+	messageKeys = []string{"msg", "message"}
+	timeKeys    = []string{"time", "ts", "timestamp", "@timestamp"}
+)
+
+// levelRanks orders normalized level names for level comparisons.
+var levelRanks = map[string]int{
+	"trace": 0, "debug": 1, "info": 2, "warn": 3, "error": 4, "dpanic": 5, "panic": 6, "fatal": 7,
+}
+
+// LogCondition is one structured filter, such as "level>=warn" or
+// "field.user_id=123".
+type LogCondition struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// condOps lists the two-character operators first, so that ">=" isn't read
+// as ">".
+var condOps = []string{">=", "<=", "!=", ">", "<", "="}
+
+// ParseLogCondition parses "level<op>name" or "field.<path><op>value" with
+// op one of = != > >= < <=. Field paths use dots for nested objects. The
+// first operator in s splits it, so values may contain operator characters
+// ("field.url=a>b").
+func ParseLogCondition(s string) (LogCondition, error) {
+	i, op := findCondOp(s)
+	if op == "" {
+		return LogCondition{}, fmt.Errorf("condition %q has no operator", s)
+	}
+
+	value := s[i+len(op):]
+	c := LogCondition{Key: strings.TrimSpace(s[:i]), Op: op, Value: strings.TrimSpace(value)}
+	switch {
+	case c.Key == "level":
+		c.Value = normalizeLevel(c.Value)
+		if _, ok := levelRanks[c.Value]; !ok {
+			return LogCondition{}, fmt.Errorf("unknown level %q", value)
+		}
+	case strings.HasPrefix(c.Key, "field.") && len(c.Key) > len("field."):
+	default:
+		return LogCondition{}, fmt.Errorf("condition %q must use level or field.<name>", s)
+	}
+	return c, nil
+}
+
+// findCondOp returns the position and text of the earliest operator in s,
+// or "" when there is none.
+func findCondOp(s string) (int, string) {
+	for i := range s {
+		for _, op := range condOps {
+			if strings.HasPrefix(s[i:], op) {
+				return i, op
+			}
+		}
+	}
+	return -1, ""
+}
+
+// LogParser is the JSON parsing stage of a log stream. Lines that parse get
+// a Structured part; other lines stay plain text. When conditions are set,
+// only JSON lines satisfying all of them pass, since plain lines have no
+// level or fields to test.
+type LogParser struct {
+	Conditions []LogCondition
+}
+
+// Apply parses a finished list of lines.
+func (p *LogParser) Apply(lines []LogEvent) []LogEvent {
+	if p == nil {
+		return lines
+	}
+	out := []LogEvent{}
+	for _, ev := range lines {
+		out = append(out, p.process(ev)...)
+	}
+	return out
+}
+
+// ParseLogEvents applies p to a log stream.
+func ParseLogEvents(ctx context.Context, in <-chan LogEvent, p *LogParser) <-chan LogEvent {
+	if p == nil {
+		return in
+	}
+	return pipeLogEvents(ctx, in, p.process)
+}
+
+func (p *LogParser) process(ev LogEvent) []LogEvent {
+	if ev.Type != LogLineEvent {
+		return []LogEvent{ev}
+	}
+	ev.Structured = parseJSONLine(ev.Line)
+	if len(p.Conditions) > 0 {
+		if ev.Structured == nil {
+			return nil
+		}
+		for _, c := range p.Conditions {
+			if !c.matches(ev.Structured) {
+				return nil
+			}
+		}
+	}
+	return []LogEvent{ev}
+}
+
+// parseJSONLine returns nil for lines that aren't a JSON object.
+func parseJSONLine(line string) *StructuredLog {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "{") {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil
+	}
+
+	s := &StructuredLog{Fields: obj}
+	if v, ok := takeKey(obj, levelKeys); ok {
+		s.Level = normalizeLevel(fmt.Sprint(v))
+	}
+	if v, ok := takeKey(obj, messageKeys); ok {
+		s.Message = fmt.Sprint(v)
+	}
+	if v, ok := takeKey(obj, timeKeys); ok {
+		s.Time = fmt.Sprint(v)
+	}
+	if len(obj) == 0 {
+		s.Fields = nil
+	}
+	return s
+}
+
+// takeKey removes and returns the first of keys present in obj.
+func takeKey(obj map[string]any, keys []string) (any, bool) {
+	for _, k := range keys {
+		if v, ok := obj[k]; ok {
+			delete(obj, k)
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// normalizeLevel maps level spellings ("WARNING", "E", bunyan's 40) onto the
+// names in levelRanks. Unknown levels are returned lowercased.
+func normalizeLevel(level string) string {
+	l := strings.ToLower(strings.TrimSpace(level))
+	switch l {
+	case "trc", "10":
+		return "trace"
+	case "dbg", "d", "20":
+		return "debug"
+	case "information", "inf", "i", "30":
+		return "info"
+	case "warning", "wrn", "w", "40":
+		return "warn"
+	case "err", "e", "50":
+		return "error"
+	case "critical", "crit", "crt", "f", "60":
+		return "fatal"
+	}
+	return l
+}
+
+func (c LogCondition) matches(s *StructuredLog) bool {
+	if c.Key == "level" {
+		rank, ok := levelRanks[s.Level]
+		if !ok {
+			return false
+		}
+		return compareOrdered(rank-levelRanks[c.Value], c.Op)
+	}
+
+	v, ok := lookupField(s.Fields, strings.TrimPrefix(c.Key, "field."))
+	if !ok {
+		return c.Op == "!="
+	}
+	got := fmt.Sprint(v)
+
+	// Compare numerically when both sides are numbers.
+	if a, err := strconv.ParseFloat(got, 64); err == nil {
+		if b, err := strconv.ParseFloat(c.Value, 64); err == nil {
+			switch {
+			case a < b:
+				return compareOrdered(-1, c.Op)
+			case a > b:
+				return compareOrdered(1, c.Op)
+			}
+			return compareOrdered(0, c.Op)
+		}
+	}
+	return compareOrdered(strings.Compare(got, c.Value), c.Op)
+}
+
+// lookupField follows a dotted path through nested objects. A key that
+// itself contains dots (e.g. "http.status" in a flat object) is tried first.
+func lookupField(fields map[string]any, path string) (any, bool) {
+	if v, ok := fields[path]; ok {
+		return v, true
+	}
+	head, rest, ok := strings.Cut(path, ".")
+	if !ok {
+		return nil, false
+	}
+	nested, isMap := fields[head].(map[string]any)
+	if !isMap {
+		return nil, false
+	}
+	return lookupField(nested, rest)
+}
+
+// compareOrdered reports whether cmp (<0, 0, >0) satisfies op.
+func compareOrdered(cmp int, op string) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
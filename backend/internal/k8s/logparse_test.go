@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseLogCondition(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    LogCondition
+		wantErr bool
+	}{
+		{in: "level>=warn", want: LogCondition{Key: "level", Op: ">=", Value: "warn"}},
+		{in: "level = WARNING", want: LogCondition{Key: "level", Op: "=", Value: "warn"}},
+		{in: "level<E", want: LogCondition{Key: "level", Op: "<", Value: "error"}},
+		{in: "field.user_id=123", want: LogCondition{Key: "field.user_id", Op: "=", Value: "123"}},
+		{in: "field.http.status!=200", want: LogCondition{Key: "field.http.status", Op: "!=", Value: "200"}},
+		{in: "field.latency<=1.5", want: LogCondition{Key: "field.latency", Op: "<=", Value: "1.5"}},
+		{in: "field.n>10", want: LogCondition{Key: "field.n", Op: ">", Value: "10"}},
+
+		// Operator characters in the value belong to the value.
+		{in: "field.url=a>b", want: LogCondition{Key: "field.url", Op: "=", Value: "a>b"}},
+		{in: "field.msg=x<=y", want: LogCondition{Key: "field.msg", Op: "=", Value: "x<=y"}},
+		{in: "field.expr!=a=b", want: LogCondition{Key: "field.expr", Op: "!=", Value: "a=b"}},
+		{in: "field.q>=a!=b", want: LogCondition{Key: "field.q", Op: ">=", Value: "a!=b"}},
+		{in: "field.empty=", want: LogCondition{Key: "field.empty", Op: "=", Value: ""}},
+
+		{in: "level>=loud", wantErr: true},
+		{in: "field.=x", wantErr: true},
+		{in: "user=bob", wantErr: true},
+		{in: "field.user", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLogCondition(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLogCondition(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLogCondition(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestLogConditionMatches(t *testing.T) {
+	line := parseJSONLine(`{"level":"WARNING","msg":"slow","ts":"2024-01-01T00:00:00Z","latency":1.5,"user":"bob","http":{"status":503},"http.method":"GET"}`)
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{"level>=warn", true},
+		{"level>warn", false},
+		{"level<=info", false},
+		{"level!=error", true},
+		{"field.latency>1", true},
+		{"field.latency<=1.5", true},
+		{"field.latency>10", false},
+		{"field.user=bob", true},
+		{"field.user<carol", true},
+		{"field.http.status>=500", true},
+		{"field.http.method=GET", true},
+		{"field.missing=x", false},
+		{"field.missing!=x", true},
+	}
+	for _, tt := range tests {
+		c, err := ParseLogCondition(tt.cond)
+		if err != nil {
+			t.Fatalf("ParseLogCondition(%q): %v", tt.cond, err)
+		}
+		if got := c.matches(line); got != tt.want {
+			t.Errorf("%s matches = %v, want %v", tt.cond, got, tt.want)
+		}
+	}
+}
+
+func TestParseJSONLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want *StructuredLog
+	}{
+		{"plain text", nil},
+		{`{"broken":`, nil},
+		{`["array"]`, nil},
+		{
+			`  {"severity":"E","message":"boom","@timestamp":"t1","code":7}`,
+			&StructuredLog{Level: "error", Message: "boom", Time: "t1", Fields: map[string]any{"code": json.Number("7")}},
+		},
+		{`{"lvl":"40","msg":"x"}`, &StructuredLog{Level: "warn", Message: "x"}},
+	}
+	for _, tt := range tests {
+		if got := parseJSONLine(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseJSONLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestLogParserApply(t *testing.T) {
+	lines := []LogEvent{
+		{Type: LogLineEvent, Line: `{"level":"info","msg":"ok"}`},
+		{Type: LogLineEvent, Line: `{"level":"error","msg":"bad","user":"bob"}`},
+		{Type: LogLineEvent, Line: "plain error"},
+		{Type: LogErrorEvent},
+	}
+
+	var nilParser *LogParser
+	if got := nilParser.Apply(lines); len(got) != len(lines) {
+		t.Errorf("nil parser dropped lines: %d", len(got))
+	}
+
+	all := (&LogParser{}).Apply(lines)
+	if len(all) != 4 || all[0].Structured == nil || all[2].Structured != nil {
+		t.Errorf("parser without conditions = %+v", all)
+	}
+
+	cond, _ := ParseLogCondition("level>=warn")
+	user, _ := ParseLogCondition("field.user=bob")
+	got := (&LogParser{Conditions: []LogCondition{cond, user}}).Apply(lines)
+	if len(got) != 2 || got[0].Structured == nil || got[0].Structured.Message != "bad" || got[1].Type != LogErrorEvent {
+		t.Errorf("filtered = %+v, want the error line and the non-line event", got)
+	}
+}
@@ -0,0 +1,589 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Log stream event types. Line carries one log line; attach and detach
+// report containers joining and leaving an aggregated stream; end and error
+// are the last event of a single-container stream, and end also closes an
+// aggregated stream that doesn't follow.
+const (
+	LogLineEvent   = "line"
+	LogAttachEvent = "attach"
+	LogDetachEvent = "detach"
+	LogEndEvent    = "end"
+	LogErrorEvent  = "error"
+)
+
+// LogEvent is one message of a log stream.
+type LogEvent struct {
+	Type      string `json:"-"`
+	Timestamp string `json:"ts,omitempty"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Line      string `json:"line,omitempty"`
+
+	// Matches are the [start, end) character offsets of a LogFilter's
+	// include pattern in Line; Context marks lines shown only as context.
+	Matches [][2]int `json:"matches,omitempty"`
+	Context bool     `json:"context,omitempty"`
+
+	// Structured is set by the JSON parsing stage for JSON lines.
+	Structured *StructuredLog `json:"structured,omitempty"`
+
+	// Seq numbers the lines of one container that share Timestamp, so
+	// lines logged in the same instant still get distinct event IDs.
+	Seq int `json:"-"`
+
+	// Err is set on LogErrorEvent.
+	Err error `json:"-"`
+}
+
+// EventID returns the SSE event ID of a line event, "<ts>;<pod>/<container>;<seq>",
+// or "" for lines without a timestamp.
+func (ev LogEvent) EventID() string {
+	if ev.Timestamp == "" {
+		return ""
+	}
+	return ev.Timestamp + ";" + ev.Pod + "/" + ev.Container + ";" + strconv.Itoa(ev.Seq)
+}
+
+// LogResume is where a reconnecting client left off: the line with event ID
+// (After, Pod, Container, Seq). Lines before After are dropped, and so are
+// the lines of that container at After up to Seq. Other containers' lines at
+// exactly After are kept, since the client can't have seen them all.
+type LogResume struct {
+	After     time.Time
+	Pod       string
+	Container string
+	Seq       int
+}
+
+// ParseLogResume parses a Last-Event-ID as written by LogEvent.EventID. An
+// empty or malformed ID means "start from the beginning".
+func ParseLogResume(id string) *LogResume {
+	parts := strings.Split(id, ";")
+	if len(parts) != 3 {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil
+	}
+	pod, container, ok := strings.Cut(parts[1], "/")
+	if !ok {
+		return nil
+	}
+	seq, err := strconv.Atoi(parts[2])
+	if err != nil || seq < 0 {
+		return nil
+	}
+	return &LogResume{After: t, Pod: pod, Container: container, Seq: seq}
+}
+
+// sinceTime returns the PodLogOptions.SinceTime that covers r. The API only
+// has second precision, so the rest is filtered line by line.
+func (r *LogResume) sinceTime() *metav1.Time {
+	if r == nil {
+		return nil
+	}
+	t := metav1.NewTime(r.After.Truncate(time.Second))
+	return &t
+}
+
+// DefaultLogOptions are the options log requests start from: follow the
+// last 100 lines, with timestamps so lines carry ts and resumable IDs.
+func DefaultLogOptions() *v1.PodLogOptions {
+	tail := int64(100)
+	return &v1.PodLogOptions{
+		Follow:     true,
+		TailLines:  &tail,
+		Timestamps: true,
+	}
+}
+
+// withResume returns a copy of opts that continues after resume instead of
+// applying the caller's tail or since window.
+func withResume(opts *v1.PodLogOptions, resume *LogResume) *v1.PodLogOptions {
+	opts = opts.DeepCopy()
+	if resume != nil {
+		opts.SinceTime = resume.sinceTime()
+		opts.SinceSeconds = nil
+		opts.TailLines = nil
+	}
+	return opts
+}
+
+// DeploymentSelector returns the label selector of a deployment's pods.
+func DeploymentSelector(ctx context.Context, cl *Cluster, namespace, name string) (string, error) {
+	return WorkloadSelector(ctx, cl, namespace, "deployments", name)
+}
+
+// WorkloadKinds lists the owner types WorkloadSelector accepts.
+var WorkloadKinds = []string{"deployments", "statefulsets", "daemonsets", "replicasets", "jobs"}
+
+// WorkloadSelector returns the label selector of a workload's pods.
+func WorkloadSelector(ctx context.Context, cl *Cluster, namespace, kind, name string) (string, error) {
+	apps := cl.Clientset.AppsV1()
+	get := metav1.GetOptions{}
+
+	var sel *metav1.LabelSelector
+	switch kind {
+	case "deployments":
+		obj, err := apps.Deployments(namespace).Get(ctx, name, get)
+		if err != nil {
+			return "", err
+		}
+		sel = obj.Spec.Selector
+	case "statefulsets":
+		obj, err := apps.StatefulSets(namespace).Get(ctx, name, get)
+		if err != nil {
+			return "", err
+		}
+		sel = obj.Spec.Selector
+	case "daemonsets":
+		obj, err := apps.DaemonSets(namespace).Get(ctx, name, get)
+		if err != nil {
+			return "", err
+		}
+		sel = obj.Spec.Selector
+	case "replicasets":
+		obj, err := apps.ReplicaSets(namespace).Get(ctx, name, get)
+		if err != nil {
+			return "", err
+		}
+		sel = obj.Spec.Selector
+	case "jobs":
+		obj, err := cl.Clientset.BatchV1().Jobs(namespace).Get(ctx, name, get)
+		if err != nil {
+			return "", err
+		}
+		sel = obj.Spec.Selector
+	default:
+		return "", unsupportedKind("select pods of", kind)
+	}
+
+	s, err := metav1.LabelSelectorAsSelector(sel)
+	if err != nil {
+		return "", err
+	}
+	return s.String(), nil
+}
+
+// StreamPodLogs streams one container's log line by line. It ends with an
+// end event when the log is finished (the container exited, or opts doesn't
+// follow) or an error event if reading fails, and the channel is then
+// closed. Opening the stream happens before returning, so API errors are
+// returned directly.
+func StreamPodLogs(ctx context.Context, cl *Cluster, namespace, pod string, opts *v1.PodLogOptions, resume *LogResume) (<-chan LogEvent, error) {
+	opts = withResume(opts, resume)
+	container := opts.Container
+
+	rc, err := cl.Clientset.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan LogEvent, 64)
+	send := func(ev LogEvent) {
+		select {
+		case out <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(out)
+		defer rc.Close()
+
+		err := readLogLines(rc, pod, container, opts.Timestamps, resume, send)
+		switch {
+		case ctx.Err() != nil:
+		case err != nil:
+			send(LogEvent{Type: LogErrorEvent, Pod: pod, Container: container, Err: err})
+		default:
+			send(LogEvent{Type: LogEndEvent, Pod: pod, Container: container})
+		}
+	}()
+	return out, nil
+}
+
+// PodLogSnapshot reads one container's log to the end without following.
+func PodLogSnapshot(ctx context.Context, cl *Cluster, namespace, pod string, opts *v1.PodLogOptions) ([]LogEvent, error) {
+	opts = opts.DeepCopy()
+	opts.Follow = false
+
+	rc, err := cl.Clientset.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	lines := []LogEvent{}
+	err = readLogLines(rc, pod, opts.Container, opts.Timestamps, nil, func(ev LogEvent) {
+		lines = append(lines, ev)
+	})
+	return lines, err
+}
+
+// SelectorLogSnapshot reads the logs of every container (or every container
+// named opts.Container) of the pods matching selector, merged in timestamp
+// order. Containers that have no log to return, such as ones that haven't
+// started, are skipped.
+func SelectorLogSnapshot(ctx context.Context, cl *Cluster, namespace, selector string, opts *v1.PodLogOptions) ([]LogEvent, error) {
+	pods, err := cl.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []LogEvent{}
+	for _, pod := range pods.Items {
+		for _, ct := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+			if opts.Container != "" && ct.Name != opts.Container {
+				continue
+			}
+			ctOpts := opts.DeepCopy()
+			ctOpts.Container = ct.Name
+			got, err := PodLogSnapshot(ctx, cl, namespace, pod.Name, ctOpts)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Printf("skipping logs of %s/%s/%s: %v", namespace, pod.Name, ct.Name, err)
+				continue
+			}
+			lines = append(lines, got...)
+		}
+	}
+
+	sortLogEvents(lines)
+	return lines, nil
+}
+
+// sortLogEvents orders lines from several containers by timestamp.
+// RFC3339Nano strings don't sort lexically (trailing zeros are trimmed), so
+// parsed times are compared; lines without one sort by their zero time and
+// keep their relative order.
+func sortLogEvents(lines []LogEvent) {
+	type keyed struct {
+		t  time.Time
+		ev LogEvent
+	}
+	keys := make([]keyed, len(lines))
+	for i, ev := range lines {
+		t, _ := time.Parse(time.RFC3339Nano, ev.Timestamp)
+		keys[i] = keyed{t, ev}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].t.Before(keys[j].t) })
+	for i := range keys {
+		lines[i] = keys[i].ev
+	}
+}
+
+// maxLogLine caps the bytes kept of one log line; the rest of a longer line
+// is dropped and replaced by logLineTruncated.
+const (
+	maxLogLine       = 64 << 10
+	logLineTruncated = " [truncated]"
+)
+
+// readLogLines reads a log, emitting one line event per line. For logs
+// requested with Timestamps the timestamp is split off into Timestamp and
+// lines sharing one are numbered in Seq. Lines longer than maxLogLine are
+// truncated. It returns nil at the end of the log.
+func readLogLines(r io.Reader, pod, container string, timestamps bool, resume *LogResume, emit func(LogEvent)) error {
+	br := bufio.NewReader(r)
+	var lastTS string
+	seq := 0
+	for {
+		line, err := readLogLine(br)
+		if line != "" {
+			ev := LogEvent{Type: LogLineEvent, Pod: pod, Container: container}
+			ev.Line = strings.TrimSuffix(line, "\n")
+			if timestamps {
+				ev.Timestamp, ev.Line = splitLogTimestamp(ev.Line)
+			}
+			if ev.Timestamp != "" && ev.Timestamp == lastTS {
+				seq++
+			} else {
+				seq = 0
+			}
+			lastTS, ev.Seq = ev.Timestamp, seq
+			if !resume.skip(ev) {
+				emit(ev)
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// readLogLine reads up to and including the next newline like ReadString,
+// but keeps at most maxLogLine bytes of the line, cut at a rune boundary.
+func readLogLine(br *bufio.Reader) (string, error) {
+	var buf []byte
+	truncated := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !truncated {
+			if len(buf)+len(chunk) > maxLogLine {
+				buf = append(buf, chunk[:maxLogLine-len(buf)]...)
+				i := len(buf) - 1
+				for i > 0 && !utf8.RuneStart(buf[i]) {
+					i--
+				}
+				if !utf8.FullRune(buf[i:]) {
+					buf = buf[:i]
+				}
+				buf = append(buf, logLineTruncated...)
+				truncated = true
+			} else {
+				buf = append(buf, chunk...)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if truncated && len(chunk) > 0 && chunk[len(chunk)-1] == '\n' {
+			buf = append(buf, '\n')
+		}
+		return string(buf), err
+	}
+}
+
+// splitLogTimestamp separates the RFC3339 timestamp the kubelet prefixes
+// each line with. Lines without one are returned unchanged.
+func splitLogTimestamp(line string) (string, string) {
+	ts, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		ts, rest = line, ""
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return "", line
+	}
+	return t.UTC().Format(time.RFC3339Nano), rest
+}
+
+// skip reports whether the client resuming at r has already seen ev.
+func (r *LogResume) skip(ev LogEvent) bool {
+	if r == nil || ev.Timestamp == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, ev.Timestamp)
+	switch {
+	case err != nil || t.After(r.After):
+		return false
+	case t.Before(r.After):
+		return true
+	}
+	return ev.Pod == r.Pod && ev.Container == r.Container && ev.Seq <= r.Seq
+}
+
+// FollowSelectorLogs fans in the logs of every pod matching selector, like
+// stern. A pod watch attaches containers as they start running and detaches
+// them when their pod goes away; containers already running when the stream
+// starts are read with opts (tail, since), or from where resume left off,
+// and later ones from their first line. opts.Container limits the stream to
+// containers of that name. The channel is closed when ctx is cancelled.
+//
+// Without opts.Follow only the containers running when the stream starts are
+// read, to the end of their current log; the stream then sends an end event
+// without pod or container and closes.
+func FollowSelectorLogs(ctx context.Context, cl *Cluster, namespace, selector string, opts *v1.PodLogOptions, resume *LogResume) (<-chan LogEvent, error) {
+	// Validate the selector before starting anything.
+	if _, err := cl.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector, Limit: 1}); err != nil {
+		return nil, err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(cl.Clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.LabelSelector = selector }))
+	podInformer := factory.Core().V1().Pods().Informer()
+
+	ctx, cancel := context.WithCancel(ctx)
+	a := &logAggregator{
+		cl:        cl,
+		namespace: namespace,
+		opts:      withResume(opts, resume),
+		resume:    resume,
+		ctx:       ctx,
+		out:       make(chan LogEvent, 64),
+		streams:   map[string]context.CancelFunc{},
+		attached:  map[string]string{},
+	}
+
+	reg, err := podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { a.sync(obj) },
+		UpdateFunc: func(_, obj any) { a.sync(obj) },
+		DeleteFunc: func(obj any) {
+			if tomb, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tomb.Obj
+			}
+			if pod, ok := obj.(*v1.Pod); ok {
+				a.detachPod(pod)
+			}
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		factory.Start(ctx.Done())
+		cache.WaitForCacheSync(ctx.Done(), reg.HasSynced)
+		a.mu.Lock()
+		a.synced = true
+		a.mu.Unlock()
+
+		if a.opts.Follow {
+			<-ctx.Done()
+		} else {
+			// No stream is attached after the initial sync, so this waits
+			// for the initial containers' logs to be read.
+			a.wg.Wait()
+			a.send(LogEvent{Type: LogEndEvent})
+		}
+		cancel()
+		factory.Shutdown()
+		a.wg.Wait()
+		close(a.out)
+	}()
+	return a.out, nil
+}
+
+type logAggregator struct {
+	cl        *Cluster
+	namespace string
+	opts      *v1.PodLogOptions
+	resume    *LogResume
+	ctx       context.Context
+	out       chan LogEvent
+	wg        sync.WaitGroup
+
+	mu sync.Mutex
+	// streams holds the cancel func of every attached "pod/container".
+	streams map[string]context.CancelFunc
+	// attached remembers the container ID last streamed per key, so a
+	// finished container isn't read again before its restart shows up.
+	attached map[string]string
+	// synced is set once the initial pod list has been handled; pods seen
+	// later are new and streamed from their first line.
+	synced bool
+}
+
+// sync attaches every running container of pod that isn't streaming yet.
+// Containers whose stream ended (restart) are re-attached here once the
+// pod's status reports them running again.
+func (a *logAggregator) sync(obj any) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod.DeletionTimestamp != nil {
+		return
+	}
+
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.synced && !a.opts.Follow {
+		return
+	}
+	for _, st := range statuses {
+		name := st.Name
+		if st.State.Running == nil || (a.opts.Container != "" && name != a.opts.Container) {
+			continue
+		}
+		key := pod.Name + "/" + name
+		if _, ok := a.streams[key]; ok || a.attached[key] == st.ContainerID {
+			continue
+		}
+		a.attached[key] = st.ContainerID
+
+		opts := a.opts.DeepCopy()
+		opts.Container = name
+		if a.synced {
+			opts.TailLines, opts.SinceSeconds, opts.SinceTime = nil, nil, nil
+		}
+		ctx, cancel := context.WithCancel(a.ctx)
+		a.streams[key] = cancel
+		a.wg.Add(1)
+		go a.stream(ctx, pod.Name, opts)
+	}
+}
+
+func (a *logAggregator) detachPod(pod *v1.Pod) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, cancel := range a.streams {
+		if strings.HasPrefix(key, pod.Name+"/") {
+			cancel()
+		}
+	}
+	for key := range a.attached {
+		if strings.HasPrefix(key, pod.Name+"/") {
+			delete(a.attached, key)
+		}
+	}
+}
+
+// stream follows one container's log until it ends or is detached.
+func (a *logAggregator) stream(ctx context.Context, pod string, opts *v1.PodLogOptions) {
+	defer a.wg.Done()
+	container := opts.Container
+	key := pod + "/" + container
+	attached := false
+	defer func() {
+		a.mu.Lock()
+		if cancel, ok := a.streams[key]; ok {
+			cancel()
+			delete(a.streams, key)
+		}
+		a.mu.Unlock()
+		if attached {
+			a.send(LogEvent{Type: LogDetachEvent, Pod: pod, Container: container})
+		}
+	}()
+
+	rc, err := a.cl.Clientset.CoreV1().Pods(a.namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("cannot stream logs of %s/%s: %v", a.namespace, key, err)
+		}
+		return
+	}
+	defer rc.Close()
+
+	a.send(LogEvent{Type: LogAttachEvent, Pod: pod, Container: container})
+	attached = true
+	if err := readLogLines(rc, pod, container, opts.Timestamps, a.resume, a.send); err != nil && ctx.Err() == nil {
+		log.Printf("log stream of %s/%s failed: %v", a.namespace, key, err)
+	}
+}
+
+func (a *logAggregator) send(ev LogEvent) {
+	select {
+	case a.out <- ev:
+	case <-a.ctx.Done():
+	}
+}
@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseLogResume(t *testing.T) {
+	ev := LogEvent{Timestamp: "2024-05-01T10:00:00.5Z", Pod: "web-1", Container: "app", Seq: 2}
+	r := ParseLogResume(ev.EventID())
+	if r == nil || r.Pod != "web-1" || r.Container != "app" || r.Seq != 2 || r.After.Nanosecond() != 5e8 {
+		t.Errorf("ParseLogResume(%q) = %+v", ev.EventID(), r)
+	}
+
+	for _, id := range []string{"", "2024-05-01T10:00:00Z", "x;web-1/app;0", "2024-05-01T10:00:00Z;web-1;0", "2024-05-01T10:00:00Z;web-1/app;-1"} {
+		if r := ParseLogResume(id); r != nil {
+			t.Errorf("ParseLogResume(%q) = %+v, want nil", id, r)
+		}
+	}
+	if id := (LogEvent{Pod: "web-1", Container: "app"}).EventID(); id != "" {
+		t.Errorf("EventID without a timestamp = %q", id)
+	}
+}
+
+func TestReadLogLinesResume(t *testing.T) {
+	const log = "2024-05-01T10:00:00Z first\n" +
+		"2024-05-01T10:00:01Z a\n" +
+		"2024-05-01T10:00:01Z b\n" +
+		"2024-05-01T10:00:01Z c\n" +
+		"2024-05-01T10:00:02Z last\n"
+
+	read := func(pod string, resume *LogResume) []string {
+		var got []string
+		err := readLogLines(strings.NewReader(log), pod, "app", true, resume, func(ev LogEvent) {
+			got = append(got, ev.Line+"@"+ev.EventID())
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	all := read("web-1", nil)
+	if len(all) != 5 || all[3] != "c@2024-05-01T10:00:01Z;web-1/app;2" || all[4] != "last@2024-05-01T10:00:02Z;web-1/app;0" {
+		t.Fatalf("lines = %q", all)
+	}
+
+	// Resuming after "b" keeps "c", which shares its timestamp.
+	resume := ParseLogResume("2024-05-01T10:00:01Z;web-1/app;1")
+	if got := read("web-1", resume); strings.Join(got, ",") != strings.Join(all[3:], ",") {
+		t.Errorf("resumed = %q, want %q", got, all[3:])
+	}
+
+	// Another pod's lines at the resume instant haven't been seen.
+	if got := read("web-2", resume); len(got) != 4 || !strings.HasPrefix(got[0], "a@") {
+		t.Errorf("other pod resumed = %q", got)
+	}
+}
+
+func TestFollowSelectorLogsWithoutFollow(t *testing.T) {
+	running := func(name string, labels map[string]string, containers ...string) *v1.Pod {
+		p := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, Labels: labels}}
+		for _, c := range containers {
+			p.Status.ContainerStatuses = append(p.Status.ContainerStatuses, v1.ContainerStatus{
+				Name: c, ContainerID: "containerd://" + name + c, State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+			})
+		}
+		return p
+	}
+	web := map[string]string{"app": "web"}
+	cl := fakeCluster(nil, running("web-1", web, "app"), running("web-2", web, "app", "proxy"), running("db", nil, "db"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := FollowSelectorLogs(ctx, cl, "shop", "app=web", &v1.PodLogOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The channel closes by itself once every container has been read.
+	var got []string
+	for ev := range events {
+		got = append(got, ev.Type+" "+ev.Pod+"/"+ev.Container+" "+ev.Line)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("stream did not end before the deadline")
+	}
+	if len(got) == 0 || got[len(got)-1] != "end / " {
+		t.Fatalf("events = %q, want a final end event", got)
+	}
+	got = got[:len(got)-1]
+	sort.Strings(got)
+	want := []string{
+		"attach web-1/app ", "attach web-2/app ", "attach web-2/proxy ",
+		"detach web-1/app ", "detach web-2/app ", "detach web-2/proxy ",
+		"line web-1/app fake logs", "line web-2/app fake logs", "line web-2/proxy fake logs",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestReadLogLinesTruncatesLongLines(t *testing.T) {
+	const ts = "2024-05-01T10:00:00Z "
+	long := strings.Repeat("x", maxLogLine-len(ts)-1) + "é" + strings.Repeat("y", 3*maxLogLine)
+	log := ts + long + "\n2024-05-01T10:00:01Z next\n"
+
+	var got []LogEvent
+	if err := readLogLines(strings.NewReader(log), "web-1", "app", true, nil, func(ev LogEvent) { got = append(got, ev) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].Line != "next" {
+		t.Fatalf("%d lines, want the long one and next", len(got))
+	}
+	// The cut falls inside "é", which is dropped rather than split; the
+	// timestamp counts towards the limit.
+	line := got[0].Line
+	want := strings.Repeat("x", maxLogLine-len(ts)-1) + logLineTruncated
+	if got[0].Timestamp != "2024-05-01T10:00:00Z" || line != want {
+		t.Errorf("truncated line has %d bytes, ends with %q", len(line), line[max(0, len(line)-20):])
+	}
+}
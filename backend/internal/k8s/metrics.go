@@ -0,0 +1,307 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podMetricsList and nodeMetricsList decode the metrics.k8s.io/v1beta1
+// list responses; only the fields webk8s uses are declared.
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+type podMetrics struct {
+	Metadata   metav1.ObjectMeta `json:"metadata"`
+	Timestamp  metav1.Time       `json:"timestamp"`
+	Containers []struct {
+		Name  string          `json:"name"`
+		Usage v1.ResourceList `json:"usage"`
+	} `json:"containers"`
+}
+
+type nodeMetricsList struct {
+	Items []nodeMetrics `json:"items"`
+}
+
+type nodeMetrics struct {
+	Metadata  metav1.ObjectMeta `json:"metadata"`
+	Timestamp metav1.Time       `json:"timestamp"`
+	Usage     v1.ResourceList   `json:"usage"`
+}
+
+// Usage is CPU in millicores and memory in bytes, with the matching
+// requests and limits. Percentages are nil when the reference is unset.
+type Usage struct {
+	CPU           int64    `json:"cpu"`
+	Memory        int64    `json:"memory"`
+	CPURequest    int64    `json:"cpuRequest"`
+	CPULimit      int64    `json:"cpuLimit"`
+	MemoryRequest int64    `json:"memoryRequest"`
+	MemoryLimit   int64    `json:"memoryLimit"`
+	CPURequestPct *float64 `json:"cpuRequestPct"`
+	CPULimitPct   *float64 `json:"cpuLimitPct"`
+	MemRequestPct *float64 `json:"memoryRequestPct"`
+	MemLimitPct   *float64 `json:"memoryLimitPct"`
+}
+
+// ContainerUsage is one container's row of a PodUsage.
+type ContainerUsage struct {
+	Name string `json:"name"`
+	Usage
+}
+
+// PodUsage is one row of /api/metrics/pods.
+type PodUsage struct {
+	Name       string           `json:"name"`
+	Namespace  string           `json:"namespace"`
+	Timestamp  string           `json:"timestamp"`
+	Containers []ContainerUsage `json:"containers"`
+	Usage
+}
+
+// NodeUsage is one row of /api/metrics/nodes. Requests and limits are the
+// sums over the node's running pods; percentages are of allocatable.
+type NodeUsage struct {
+	Name              string   `json:"name"`
+	Timestamp         string   `json:"timestamp"`
+	CPU               int64    `json:"cpu"`
+	Memory            int64    `json:"memory"`
+	CPUAllocatable    int64    `json:"cpuAllocatable"`
+	MemoryAllocatable int64    `json:"memoryAllocatable"`
+	CPUCapacity       int64    `json:"cpuCapacity"`
+	MemoryCapacity    int64    `json:"memoryCapacity"`
+	CPURequests       int64    `json:"cpuRequests"`
+	MemoryRequests    int64    `json:"memoryRequests"`
+	CPULimits         int64    `json:"cpuLimits"`
+	MemoryLimits      int64    `json:"memoryLimits"`
+	CPUPct            *float64 `json:"cpuPct"`
+	MemoryPct         *float64 `json:"memoryPct"`
+	CPURequestsPct    *float64 `json:"cpuRequestsPct"`
+	MemoryRequestsPct *float64 `json:"memoryRequestsPct"`
+}
+
+// ListPodMetrics returns the usage of every pod in namespace (all
+// namespaces when empty) from one PodMetrics list call, like
+// `kubectl top pods`, next to the pods' requests and limits.
+func ListPodMetrics(ctx context.Context, cl *Cluster, namespace string) ([]PodUsage, error) {
+	list, err := fetchPodMetrics(ctx, cl, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := listPods(ctx, cl, namespace)
+	if err != nil {
+		return nil, err
+	}
+	specs := map[string]*v1.Pod{}
+	for _, p := range pods {
+		specs[p.Namespace+"/"+p.Name] = p
+	}
+
+	out := make([]PodUsage, 0, len(list.Items))
+	for _, m := range list.Items {
+		pu := PodUsage{
+			Name:       m.Metadata.Name,
+			Namespace:  m.Metadata.Namespace,
+			Timestamp:  m.Timestamp.Time.Format("2006-01-02T15:04:05Z"),
+			Containers: []ContainerUsage{},
+		}
+		pod := specs[pu.Namespace+"/"+pu.Name]
+
+		// A pod limit is only meaningful when every container has one.
+		cpuLimited, memLimited := true, true
+		for _, ct := range m.Containers {
+			cu := ContainerUsage{Name: ct.Name}
+			cu.CPU = ct.Usage.Cpu().MilliValue()
+			cu.Memory = ct.Usage.Memory().Value()
+			if spec := containerSpec(pod, ct.Name); spec != nil {
+				cu.CPURequest = spec.Resources.Requests.Cpu().MilliValue()
+				cu.CPULimit = spec.Resources.Limits.Cpu().MilliValue()
+				cu.MemoryRequest = spec.Resources.Requests.Memory().Value()
+				cu.MemoryLimit = spec.Resources.Limits.Memory().Value()
+			}
+			cu.Usage.fillPct()
+
+			pu.CPU += cu.CPU
+			pu.Memory += cu.Memory
+			pu.CPURequest += cu.CPURequest
+			pu.CPULimit += cu.CPULimit
+			pu.MemoryRequest += cu.MemoryRequest
+			pu.MemoryLimit += cu.MemoryLimit
+			cpuLimited = cpuLimited && cu.CPULimit > 0
+			memLimited = memLimited && cu.MemoryLimit > 0
+			pu.Containers = append(pu.Containers, cu)
+		}
+		if !cpuLimited {
+			pu.CPULimit = 0
+		}
+		if !memLimited {
+			pu.MemoryLimit = 0
+		}
+		pu.Usage.fillPct()
+		out = append(out, pu)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// ListNodeMetrics returns the usage of every node, like `kubectl top
+// nodes`, next to its allocatable resources and the requests of its pods.
+func ListNodeMetrics(ctx context.Context, cl *Cluster) ([]NodeUsage, error) {
+	list, err := fetchNodeMetrics(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := cl.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodeSpecs := map[string]*v1.Node{}
+	for i := range nodes.Items {
+		nodeSpecs[nodes.Items[i].Name] = &nodes.Items[i]
+	}
+
+	pods, err := listPods(ctx, cl, "")
+	if err != nil {
+		return nil, err
+	}
+	type totals struct{ cpuReq, memReq, cpuLim, memLim int64 }
+	perNode := map[string]*totals{}
+	for _, p := range pods {
+		if p.Spec.NodeName == "" || p.Status.Phase == v1.PodSucceeded || p.Status.Phase == v1.PodFailed {
+			continue
+		}
+		t := perNode[p.Spec.NodeName]
+		if t == nil {
+			t = &totals{}
+			perNode[p.Spec.NodeName] = t
+		}
+		for _, ct := range p.Spec.Containers {
+			t.cpuReq += ct.Resources.Requests.Cpu().MilliValue()
+			t.memReq += ct.Resources.Requests.Memory().Value()
+			t.cpuLim += ct.Resources.Limits.Cpu().MilliValue()
+			t.memLim += ct.Resources.Limits.Memory().Value()
+		}
+	}
+
+	out := make([]NodeUsage, 0, len(list.Items))
+	for _, m := range list.Items {
+		nu := NodeUsage{
+			Name:      m.Metadata.Name,
+			Timestamp: m.Timestamp.Time.Format("2006-01-02T15:04:05Z"),
+			CPU:       m.Usage.Cpu().MilliValue(),
+			Memory:    m.Usage.Memory().Value(),
+		}
+		if node := nodeSpecs[nu.Name]; node != nil {
+			nu.CPUAllocatable = node.Status.Allocatable.Cpu().MilliValue()
+			nu.MemoryAllocatable = node.Status.Allocatable.Memory().Value()
+			nu.CPUCapacity = node.Status.Capacity.Cpu().MilliValue()
+			nu.MemoryCapacity = node.Status.Capacity.Memory().Value()
+		}
+		if t := perNode[nu.Name]; t != nil {
+			nu.CPURequests, nu.MemoryRequests = t.cpuReq, t.memReq
+			nu.CPULimits, nu.MemoryLimits = t.cpuLim, t.memLim
+		}
+		nu.CPUPct = percent(nu.CPU, nu.CPUAllocatable)
+		nu.MemoryPct = percent(nu.Memory, nu.MemoryAllocatable)
+		nu.CPURequestsPct = percent(nu.CPURequests, nu.CPUAllocatable)
+		nu.MemoryRequestsPct = percent(nu.MemoryRequests, nu.MemoryAllocatable)
+		out = append(out, nu)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// fetchPodMetrics lists the PodMetrics of namespace (all when empty) from
+// the cluster's metrics provider.
+func fetchPodMetrics(ctx context.Context, cl *Cluster, namespace string) (*podMetricsList, error) {
+	raw, err := metricsProviderFor(cl).PodMetricsList(ctx, cl, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var list podMetricsList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// fetchNodeMetrics lists the NodeMetrics of every node from the cluster's
+// metrics provider.
+func fetchNodeMetrics(ctx context.Context, cl *Cluster) (*nodeMetricsList, error) {
+	raw, err := metricsProviderFor(cl).NodeMetricsList(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+	var list nodeMetricsList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// listPods returns the pods of namespace from the informer cache once it
+// has synced, and from the API server until then.
+func listPods(ctx context.Context, cl *Cluster, namespace string) ([]*v1.Pod, error) {
+	if objs, ok := cl.ResourceCache().List("pods", namespace); ok {
+		out := make([]*v1.Pod, 0, len(objs))
+		for _, obj := range objs {
+			if p, ok := obj.(*v1.Pod); ok {
+				out = append(out, p)
+			}
+		}
+		return out, nil
+	}
+
+	list, err := cl.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*v1.Pod, 0, len(list.Items))
+	for i := range list.Items {
+		out = append(out, &list.Items[i])
+	}
+	return out, nil
+}
+
+func containerSpec(pod *v1.Pod, name string) *v1.Container {
+	if pod == nil {
+		return nil
+	}
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == name {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+func (u *Usage) fillPct() {
+	u.CPURequestPct = percent(u.CPU, u.CPURequest)
+	u.CPULimitPct = percent(u.CPU, u.CPULimit)
+	u.MemRequestPct = percent(u.Memory, u.MemoryRequest)
+	u.MemLimitPct = percent(u.Memory, u.MemoryLimit)
+}
+
+// percent returns value as a percentage of ref, rounded to one decimal, or
+// nil when ref is zero.
+func percent(value, ref int64) *float64 {
+	if ref <= 0 {
+		return nil
+	}
+	p := float64(int64(float64(value)*1000/float64(ref)+0.5)) / 10
+	return &p
+}
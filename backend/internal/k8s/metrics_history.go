@@ -0,0 +1,325 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of metrics history series.
+const (
+	HistoryPod  = "pod"
+	HistoryNode = "node"
+)
+
+// staleIntervals is how many successful samplings of its cluster a series may
+// be missing from (its pod or node is gone) before it is evicted. Failed
+// samplings don't count, so an outage leaves a gap instead of losing history.
+const staleIntervals = 3
+
+// ErrHistoryDisabled is returned by MetricsHistoryFor when no sampler runs.
+var ErrHistoryDisabled = errors.New("metrics history is disabled")
+
+// MetricsPoint is one (possibly downsampled) sample: CPU in millicores and
+// memory in bytes.
+type MetricsPoint struct {
+	Time   string `json:"t"`
+	CPU    int64  `json:"cpu"`
+	Memory int64  `json:"memory"`
+}
+
+// MetricsSeries is the history of one pod container, a whole pod
+// (Container empty) or a node.
+type MetricsSeries struct {
+	Container string         `json:"container,omitempty"`
+	Points    []MetricsPoint `json:"points"`
+}
+
+// MetricsHistory is the payload of /api/metrics/history.
+type MetricsHistory struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name"`
+	Interval  string          `json:"interval,omitempty"`
+	Step      string          `json:"step"`
+	Series    []MetricsSeries `json:"series"`
+}
+
+type sample struct {
+	t      time.Time
+	cpu    int64
+	memory int64
+}
+
+// ring is a fixed-size circular buffer of samples, oldest first. missed
+// counts the successful samplings in a row the series was absent from.
+type ring struct {
+	buf    []sample
+	start  int
+	n      int
+	missed int
+}
+
+func (r *ring) add(s sample) {
+	if r.n < len(r.buf) {
+		r.buf[(r.start+r.n)%len(r.buf)] = s
+		r.n++
+		return
+	}
+	r.buf[r.start] = s
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+func (r *ring) last() sample {
+	return r.buf[(r.start+r.n-1)%len(r.buf)]
+}
+
+// since returns the samples newer than t, oldest first.
+func (r *ring) since(t time.Time) []sample {
+	out := []sample{}
+	for i := 0; i < r.n; i++ {
+		s := r.buf[(r.start+i)%len(r.buf)]
+		if s.t.After(t) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// seriesKey identifies one series; Container is empty for pod totals and
+// nodes.
+type seriesKey struct {
+	Cluster   string
+	Kind      string
+	Namespace string
+	Name      string
+	Container string
+}
+
+// metricsStore holds every series in ring buffers sized for the retention.
+type metricsStore struct {
+	interval time.Duration
+	capacity int
+
+	mu     sync.RWMutex
+	series map[seriesKey]*ring
+}
+
+var history *metricsStore
+
+// StartMetricsHistory samples pod and node metrics of every cluster every
+// interval into in-memory ring buffers holding retention worth of samples.
+// It runs until ctx is cancelled.
+func StartMetricsHistory(ctx context.Context, interval, retention time.Duration) {
+	capacity := int(retention / interval)
+	if capacity < 1 {
+		capacity = 1
+	}
+	history = &metricsStore{interval: interval, capacity: capacity, series: map[seriesKey]*ring{}}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			history.sampleAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *metricsStore) sampleAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, cl := range Clusters() {
+		// Clusters whose provider keeps history (Prometheus) need no sampling.
+		if cl.Err != nil || HasMetricsRange(cl) {
+			continue
+		}
+		wg.Add(1)
+		go func(cl *Cluster) {
+			defer wg.Done()
+			sctx, cancel := context.WithTimeout(ctx, m.interval)
+			defer cancel()
+			pods, nodes := m.sample(sctx, cl)
+			if pods != nil {
+				m.evictMissing(cl.Name, HistoryPod, pods)
+			}
+			if nodes != nil {
+				m.evictMissing(cl.Name, HistoryNode, nodes)
+			}
+		}(cl)
+	}
+	wg.Wait()
+}
+
+// sample records one round for a cluster and returns the pod and node
+// series it saw. A failed fetch (metrics-server missing or slow) just leaves
+// a gap, and its set is nil.
+func (m *metricsStore) sample(ctx context.Context, cl *Cluster) (pods, nodes map[seriesKey]bool) {
+	if list, err := fetchPodMetrics(ctx, cl, ""); err != nil {
+		log.Printf("metrics history: cannot sample pod metrics of cluster %s: %v", cl.Name, err)
+	} else {
+		pods = map[seriesKey]bool{}
+		for _, p := range list.Items {
+			t := p.Timestamp.Time
+			total := sample{t: t}
+			for _, ct := range p.Containers {
+				s := sample{t: t, cpu: ct.Usage.Cpu().MilliValue(), memory: ct.Usage.Memory().Value()}
+				total.cpu += s.cpu
+				total.memory += s.memory
+				key := seriesKey{cl.Name, HistoryPod, p.Metadata.Namespace, p.Metadata.Name, ct.Name}
+				m.record(key, s)
+				pods[key] = true
+			}
+			key := seriesKey{cl.Name, HistoryPod, p.Metadata.Namespace, p.Metadata.Name, ""}
+			m.record(key, total)
+			pods[key] = true
+		}
+	}
+
+	if list, err := fetchNodeMetrics(ctx, cl); err != nil {
+		log.Printf("metrics history: cannot sample node metrics of cluster %s: %v", cl.Name, err)
+	} else {
+		nodes = map[seriesKey]bool{}
+		for _, n := range list.Items {
+			key := seriesKey{cl.Name, HistoryNode, "", n.Metadata.Name, ""}
+			m.record(key, sample{t: n.Timestamp.Time, cpu: n.Usage.Cpu().MilliValue(), memory: n.Usage.Memory().Value()})
+			nodes[key] = true
+		}
+	}
+	return pods, nodes
+}
+
+func (m *metricsStore) record(key seriesKey, s sample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := m.series[key]
+	if r == nil {
+		r = &ring{buf: make([]sample, m.capacity)}
+		m.series[key] = r
+	}
+	// metrics-server only refreshes every scrape window; skip repeats.
+	if r.n > 0 && !s.t.After(r.last().t) {
+		return
+	}
+	r.add(s)
+}
+
+// evictMissing takes the series of one cluster and kind seen by a
+// successful fetch, and drops the others of that cluster and kind once they
+// have been missing from staleIntervals such fetches in a row.
+func (m *metricsStore) evictMissing(cluster, kind string, seen map[seriesKey]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, r := range m.series {
+		if key.Cluster != cluster || key.Kind != kind {
+			continue
+		}
+		if seen[key] {
+			r.missed = 0
+			continue
+		}
+		if r.missed++; r.missed >= staleIntervals {
+			delete(m.series, key)
+		}
+	}
+}
+
+// MetricsHistorySeries returns how many history series are held for the
+// cluster (0 when the sampler is disabled).
+func MetricsHistorySeries(cl *Cluster) int {
+	m := history
+	if m == nil {
+		return 0
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := 0
+	for key := range m.series {
+		if key.Cluster == cl.Name {
+			n++
+		}
+	}
+	return n
+}
+
+// MetricsHistoryFor returns the series of a pod (the pod total plus one per
+// container) or a node over the last window, averaged into at most maxPoints
+// buckets. It returns ErrHistoryDisabled when no sampler is running and
+// found=false when there is no such series.
+func MetricsHistoryFor(cl *Cluster, kind, namespace, name string, window time.Duration, maxPoints int) (*MetricsHistory, bool, error) {
+	m := history
+	if m == nil {
+		return nil, false, ErrHistoryDisabled
+	}
+	if kind == HistoryNode {
+		namespace = ""
+	}
+
+	step := window / time.Duration(maxPoints)
+	if step < m.interval {
+		step = m.interval
+	}
+	since := time.Now().Add(-window)
+
+	m.mu.RLock()
+	var series []MetricsSeries
+	for key, r := range m.series {
+		if key.Cluster != cl.Name || key.Kind != kind || key.Namespace != namespace || key.Name != name {
+			continue
+		}
+		series = append(series, MetricsSeries{Container: key.Container, Points: downsample(r.since(since), step)})
+	}
+	m.mu.RUnlock()
+
+	if len(series) == 0 {
+		return nil, false, nil
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Container < series[j].Container })
+
+	return &MetricsHistory{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Interval:  m.interval.String(),
+		Step:      step.String(),
+		Series:    series,
+	}, true, nil
+}
+
+// downsample averages samples into step-aligned buckets.
+func downsample(samples []sample, step time.Duration) []MetricsPoint {
+	out := []MetricsPoint{}
+	var bucket time.Time
+	var cpu, memory, n int64
+	flush := func() {
+		if n > 0 {
+			out = append(out, MetricsPoint{
+				Time:   bucket.UTC().Format(time.RFC3339),
+				CPU:    cpu / n,
+				Memory: memory / n,
+			})
+		}
+	}
+
+	for _, s := range samples {
+		b := s.t.Truncate(step)
+		if !b.Equal(bucket) {
+			flush()
+			bucket, cpu, memory, n = b, 0, 0, 0
+		}
+		cpu += s.cpu
+		memory += s.memory
+		n++
+	}
+	flush()
+	return out
+}
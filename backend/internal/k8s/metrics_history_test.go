@@ -0,0 +1,197 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var historyBase = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func at(sec int) time.Time { return historyBase.Add(time.Duration(sec) * time.Second) }
+
+func TestRing(t *testing.T) {
+	r := &ring{buf: make([]sample, 3)}
+	times := func(samples []sample) []int {
+		var out []int
+		for _, s := range samples {
+			out = append(out, int(s.t.Sub(historyBase).Seconds()))
+		}
+		return out
+	}
+
+	for i := 1; i <= 2; i++ {
+		r.add(sample{t: at(i)})
+	}
+	if got := times(r.since(time.Time{})); !reflect.DeepEqual(got, []int{1, 2}) || r.last().t != at(2) {
+		t.Errorf("partly filled = %v", got)
+	}
+
+	// Two more samples overwrite the oldest one and wrap around.
+	r.add(sample{t: at(3)})
+	r.add(sample{t: at(4)})
+	r.add(sample{t: at(5)})
+	if got := times(r.since(time.Time{})); !reflect.DeepEqual(got, []int{3, 4, 5}) || r.last().t != at(5) {
+		t.Errorf("wrapped = %v, last %v", got, r.last().t)
+	}
+	if got := times(r.since(at(3))); !reflect.DeepEqual(got, []int{4, 5}) {
+		t.Errorf("since 3 = %v", got)
+	}
+	if got := r.since(at(5)); len(got) != 0 {
+		t.Errorf("since last = %v", got)
+	}
+}
+
+func TestMetricsStoreRecordAndEvict(t *testing.T) {
+	m := &metricsStore{interval: 30 * time.Second, capacity: 4, series: map[seriesKey]*ring{}}
+	web := seriesKey{"c", HistoryPod, "shop", "web", ""}
+	node := seriesKey{"c", HistoryNode, "", "node-a", ""}
+
+	m.record(web, sample{t: at(0), cpu: 1})
+	m.record(web, sample{t: at(0), cpu: 2})   // same metrics-server window
+	m.record(web, sample{t: at(-10), cpu: 3}) // out of order
+	m.record(web, sample{t: at(30), cpu: 4})
+	if r := m.series[web]; r.n != 2 || r.last().cpu != 4 {
+		t.Errorf("recorded %d samples, last %+v", r.n, r.last())
+	}
+
+	m.record(node, sample{t: at(100)})
+	other := seriesKey{"other", HistoryPod, "shop", "web", ""}
+	m.record(other, sample{t: at(0)})
+
+	// web is missing from successful pod samplings of cluster c; only the
+	// third miss in a row evicts it, and other kinds and clusters stay.
+	for i := 1; i <= staleIntervals; i++ {
+		m.evictMissing("c", HistoryPod, map[seriesKey]bool{})
+		if _, ok := m.series[web]; ok != (i < staleIntervals) {
+			t.Fatalf("after %d misses: web kept = %v", i, ok)
+		}
+	}
+	if _, ok := m.series[node]; !ok {
+		t.Error("node series evicted by a pod sampling")
+	}
+	if _, ok := m.series[other]; !ok {
+		t.Error("other cluster's series evicted")
+	}
+
+	// Being seen again resets the count.
+	m.evictMissing("c", HistoryNode, map[seriesKey]bool{})
+	m.evictMissing("c", HistoryNode, map[seriesKey]bool{node: true})
+	m.evictMissing("c", HistoryNode, map[seriesKey]bool{})
+	m.evictMissing("c", HistoryNode, map[seriesKey]bool{})
+	if _, ok := m.series[node]; !ok {
+		t.Error("node series evicted although it was seen in between")
+	}
+}
+
+// fakeMetrics serves fixed metrics lists, or err.
+type fakeMetrics struct {
+	pods, nodes string
+	err         error
+}
+
+func (f *fakeMetrics) PodMetrics(context.Context, *Cluster, string, string) ([]byte, error) {
+	return nil, f.err
+}
+
+func (f *fakeMetrics) NodeMetrics(context.Context, *Cluster, string) ([]byte, error) {
+	return nil, f.err
+}
+
+func (f *fakeMetrics) PodMetricsList(context.Context, *Cluster, string) ([]byte, error) {
+	return []byte(f.pods), f.err
+}
+
+func (f *fakeMetrics) NodeMetricsList(context.Context, *Cluster) ([]byte, error) {
+	return []byte(f.nodes), f.err
+}
+
+func TestMetricsSampleKeepsHistoryOnFailure(t *testing.T) {
+	cl := &Cluster{Name: "sampled"}
+	provider := &fakeMetrics{
+		pods:  `{"items":[{"metadata":{"namespace":"shop","name":"web"},"timestamp":"2024-05-01T10:00:00Z","containers":[{"name":"app","usage":{"cpu":"100m","memory":"1Mi"}}]}]}`,
+		nodes: `{"items":[{"metadata":{"name":"node-a"},"timestamp":"2024-05-01T10:00:00Z","usage":{"cpu":"1","memory":"1Gi"}}]}`,
+	}
+	SetMetricsProvider(cl.Name, provider)
+	t.Cleanup(func() { delete(metricsProviders, cl.Name) })
+
+	m := &metricsStore{interval: 30 * time.Second, capacity: 4, series: map[seriesKey]*ring{}}
+	pods, nodes := m.sample(context.Background(), cl)
+	if len(pods) != 2 || len(nodes) != 1 || len(m.series) != 3 {
+		t.Fatalf("seen %d pod and %d node series, stored %d", len(pods), len(nodes), len(m.series))
+	}
+
+	// metrics-server is down for longer than the eviction threshold.
+	provider.err = errors.New("the server is currently unable to handle the request")
+	for i := 0; i < staleIntervals+2; i++ {
+		pods, nodes := m.sample(context.Background(), cl)
+		if pods != nil || nodes != nil {
+			t.Fatalf("failed sampling reported seen series %v %v", pods, nodes)
+		}
+	}
+	if len(m.series) != 3 {
+		t.Errorf("%d series left after failed samplings, want 3", len(m.series))
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	samples := []sample{
+		{t: at(0), cpu: 100, memory: 10},
+		{t: at(30), cpu: 200, memory: 30},
+		{t: at(60), cpu: 50, memory: 5},
+		{t: at(150), cpu: 10, memory: 1},
+	}
+	got := downsample(samples, time.Minute)
+	want := []MetricsPoint{
+		{Time: "2024-05-01T10:00:00Z", CPU: 150, Memory: 20},
+		{Time: "2024-05-01T10:01:00Z", CPU: 50, Memory: 5},
+		{Time: "2024-05-01T10:02:00Z", CPU: 10, Memory: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("downsample = %+v, want %+v", got, want)
+	}
+	if got := downsample(nil, time.Minute); got == nil || len(got) != 0 {
+		t.Errorf("no samples = %#v, want an empty slice", got)
+	}
+}
+
+func TestMetricsHistoryFor(t *testing.T) {
+	saved := history
+	t.Cleanup(func() { history = saved })
+
+	history = nil
+	cl := &Cluster{Name: "c"}
+	if _, _, err := MetricsHistoryFor(cl, HistoryPod, "shop", "web", time.Hour, 10); !errors.Is(err, ErrHistoryDisabled) {
+		t.Errorf("disabled err = %v", err)
+	}
+
+	history = &metricsStore{interval: 30 * time.Second, capacity: 10, series: map[seriesKey]*ring{}}
+	now := time.Now()
+	for i := 4; i >= 1; i-- {
+		s := sample{t: now.Add(-time.Duration(i) * time.Minute), cpu: 100, memory: 1}
+		history.record(seriesKey{"c", HistoryPod, "shop", "web", ""}, s)
+		history.record(seriesKey{"c", HistoryPod, "shop", "web", "app"}, s)
+		history.record(seriesKey{"other", HistoryPod, "shop", "web", ""}, s)
+	}
+
+	h, found, err := MetricsHistoryFor(cl, HistoryPod, "shop", "web", time.Hour, 1000)
+	if err != nil || !found {
+		t.Fatalf("found %v, err %v", found, err)
+	}
+	// The step never drops below the sampling interval.
+	if h.Step != "30s" || h.Interval != "30s" || len(h.Series) != 2 || h.Series[0].Container != "" || h.Series[1].Container != "app" {
+		t.Errorf("history = %+v", h)
+	}
+	if n := len(h.Series[0].Points); n != 4 {
+		t.Errorf("%d points, want 4", n)
+	}
+
+	if h, _, _ := MetricsHistoryFor(cl, HistoryPod, "shop", "web", 90*time.Second, 10); len(h.Series[0].Points) != 1 {
+		t.Errorf("90s window = %+v, want the last sample only", h.Series[0].Points)
+	}
+	if _, found, _ := MetricsHistoryFor(cl, HistoryNode, "", "web", time.Hour, 10); found {
+		t.Error("found a node series for a pod")
+	}
+}
@@ -0,0 +1,138 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// MetricsProvider supplies the current usage behind GetPodMetrics,
+// GetNodeMetrics and the /api/metrics tables, encoded as metrics.k8s.io
+// PodMetrics/NodeMetrics objects (or their lists) so the UI doesn't care
+// where the numbers come from.
+type MetricsProvider interface {
+	PodMetrics(ctx context.Context, cl *Cluster, ns, pod string) ([]byte, error)
+	NodeMetrics(ctx context.Context, cl *Cluster, node string) ([]byte, error)
+	// PodMetricsList lists the pods of ns (all namespaces when empty).
+	PodMetricsList(ctx context.Context, cl *Cluster, ns string) ([]byte, error)
+	NodeMetricsList(ctx context.Context, cl *Cluster) ([]byte, error)
+}
+
+// MetricsRangeProvider is implemented by providers that keep usage history.
+// When a cluster's provider has it, that cluster's /api/metrics/history is
+// served from it instead of the in-memory sampler.
+type MetricsRangeProvider interface {
+	MetricsProvider
+	UsageRange(ctx context.Context, cl *Cluster, q UsageQuery) ([]MetricsSeries, error)
+}
+
+// UsageQuery selects the series of one pod (per container), one node or the
+// pods of a workload, sampled every Step between Start and End.
+type UsageQuery struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// Pods are the workload's current pods when Kind is a workload kind.
+	Pods  []string
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+// metricsProviders holds the providers set per cluster name; clusters
+// without one read metrics-server. It is only written during startup.
+var metricsProviders = map[string]MetricsProvider{}
+
+// SetMetricsProvider replaces the metrics-server provider of the named
+// cluster.
+func SetMetricsProvider(cluster string, p MetricsProvider) {
+	metricsProviders[cluster] = p
+}
+
+// metricsProviderFor returns the provider serving cl.
+func metricsProviderFor(cl *Cluster) MetricsProvider {
+	if p, ok := metricsProviders[cl.Name]; ok {
+		return p
+	}
+	return metricsServer{}
+}
+
+// HasMetricsRange reports whether cl's metrics provider serves history.
+func HasMetricsRange(cl *Cluster) bool {
+	_, ok := metricsProviderFor(cl).(MetricsRangeProvider)
+	return ok
+}
+
+// MetricsRange returns the usage history of a pod, node or workload (kind is
+// one of WorkloadKinds) over the last window from the range provider, in at
+// most maxPoints steps. found is false when there is no data.
+func MetricsRange(ctx context.Context, cl *Cluster, kind, namespace, name string, window time.Duration, maxPoints int) (*MetricsHistory, bool, error) {
+	rp, ok := metricsProviderFor(cl).(MetricsRangeProvider)
+	if !ok {
+		return nil, false, fmt.Errorf("metrics provider has no history")
+	}
+
+	end := time.Now()
+	q := UsageQuery{Kind: kind, Namespace: namespace, Name: name, Start: end.Add(-window), End: end, Step: window / time.Duration(maxPoints)}
+	if q.Step < time.Second {
+		q.Step = time.Second
+	}
+	if kind == HistoryNode {
+		q.Namespace = ""
+	}
+
+	if slices.Contains(WorkloadKinds, kind) {
+		pods, err := workloadPods(ctx, cl, namespace, kind, name)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(pods) == 0 {
+			return nil, false, nil
+		}
+		q.Pods = pods
+	}
+
+	series, err := rp.UsageRange(ctx, cl, q)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(series) == 0 {
+		return nil, false, nil
+	}
+
+	return &MetricsHistory{
+		Kind:      kind,
+		Namespace: q.Namespace,
+		Name:      name,
+		Step:      q.Step.String(),
+		Series:    series,
+	}, true, nil
+}
+
+// workloadPods returns the names of the pods currently matching a workload's
+// selector.
+func workloadPods(ctx context.Context, cl *Cluster, namespace, kind, name string) ([]string, error) {
+	selector, err := WorkloadSelector(ctx, cl, namespace, kind, name)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := listPods(ctx, cl, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, p := range pods {
+		if sel.Matches(labels.Set(p.Labels)) {
+			names = append(names, p.Name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,113 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// MaskedValue replaces secret values wherever webk8s shows a Secret.
+const MaskedValue = "********"
+
+// ObjectOptions controls which noisy fields GetObject strips.
+type ObjectOptions struct {
+	// Clean drops managedFields, the kubectl last-applied annotation and selfLink.
+	Clean bool
+	// DropStatus removes the whole status stanza.
+	DropStatus bool
+}
+
+// GetObject fetches the full manifest of any object through the dynamic
+// client. An empty version resolves to the group's preferred version, and the
+// namespace is ignored for cluster-scoped types. Secret values are always
+// masked; they can only be read through the audited reveal endpoint.
+func GetObject(ctx context.Context, cl *Cluster, gvr schema.GroupVersionResource, namespace, name string, opts ObjectOptions) (*unstructured.Unstructured, error) {
+	t, err := resolveGVR(ctx, cl, gvr)
+	if err != nil {
+		return nil, err
+	}
+
+	ri := cl.Dynamic.Resource(t.GVR())
+	var obj *unstructured.Unstructured
+	if t.Namespaced {
+		obj, err = ri.Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	} else {
+		obj, err = ri.Get(ctx, name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Group == "" && t.Resource == "secrets" {
+		maskSecret(obj)
+	}
+	if opts.Clean {
+		obj.SetManagedFields(nil)
+		unstructured.RemoveNestedField(obj.Object, "metadata", "selfLink")
+		if ann := obj.GetAnnotations(); ann != nil {
+			delete(ann, lastAppliedAnnotation)
+			if len(ann) == 0 {
+				ann = nil
+			}
+			obj.SetAnnotations(ann)
+		}
+	}
+	if opts.DropStatus {
+		unstructured.RemoveNestedField(obj.Object, "status")
+	}
+	return obj, nil
+}
+
+// maskSecret replaces every data and stringData value of a Secret, and the
+// last-applied annotation that may repeat them, with MaskedValue.
+func maskSecret(obj *unstructured.Unstructured) {
+	for _, field := range []string{"data", "stringData"} {
+		values, ok, _ := unstructured.NestedMap(obj.Object, field)
+		if !ok {
+			continue
+		}
+		for k := range values {
+			values[k] = MaskedValue
+		}
+		_ = unstructured.SetNestedMap(obj.Object, values, field)
+	}
+
+	if ann := obj.GetAnnotations(); ann[lastAppliedAnnotation] != "" {
+		ann[lastAppliedAnnotation] = MaskedValue
+		obj.SetAnnotations(ann)
+	}
+}
+
+// resolveGVR finds the discovered type for gvr, filling in the preferred
+// version when none is given.
+func resolveGVR(ctx context.Context, cl *Cluster, gvr schema.GroupVersionResource) (APIResourceType, error) {
+	types, err := ListResourceTypes(ctx, cl)
+	if err != nil {
+		return APIResourceType{}, err
+	}
+
+	for _, t := range types {
+		if t.Group != gvr.Group || t.Resource != gvr.Resource {
+			continue
+		}
+		if gvr.Version == "" || gvr.Version == t.Version {
+			return t, nil
+		}
+		// A non-preferred version of a known type: trust the caller.
+		t.Version = gvr.Version
+		return t, nil
+	}
+	return APIResourceType{}, &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusNotFound,
+		Reason:  metav1.StatusReasonNotFound,
+		Message: fmt.Sprintf("unknown resource %q in API group %q", gvr.Resource, gvr.Group),
+	}}
+}
@@ -0,0 +1,113 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// fakeCluster returns a cluster backed by fake clients whose discovery cache
+// already holds types, since the fake discovery client reports no resources.
+func fakeCluster(types []APIResourceType, objs ...runtime.Object) *Cluster {
+	cl := &Cluster{
+		Name: "test",
+		// Nothing listens here, so metrics requests fail fast.
+		Config:    &rest.Config{Host: "http://127.0.0.1:1"},
+		Clientset: fake.NewSimpleClientset(objs...),
+		Dynamic:   dynamicfake.NewSimpleDynamicClient(scheme.Scheme, objs...),
+	}
+	dc := cl.discovery()
+	dc.types = types
+	dc.byKey = map[string]APIResourceType{}
+	for _, t := range types {
+		dc.byKey[t.Key] = t
+	}
+	dc.fetched = time.Now()
+	return cl
+}
+
+var coreTypes = []APIResourceType{
+	{Key: "secrets", Version: "v1", Resource: "secrets", Kind: "Secret", Namespaced: true, Builtin: true},
+	{Key: "configmaps", Version: "v1", Resource: "configmaps", Kind: "ConfigMap", Namespaced: true, Builtin: true},
+}
+
+func TestGetObjectMasksSecrets(t *testing.T) {
+	sec := &v1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db",
+			Namespace: "app",
+			Annotations: map[string]string{
+				lastAppliedAnnotation: `{"stringData":{"password":"hunter2"}}`,
+				"team":                "payments",
+			},
+		},
+		Data:       map[string][]byte{"password": []byte("hunter2"), "user": []byte("admin")},
+		StringData: map[string]string{"token": "s3cr3t"},
+	}
+	cl := fakeCluster(coreTypes, sec)
+
+	for _, clean := range []bool{false, true} {
+		obj, err := GetObject(context.Background(), cl, schema.GroupVersionResource{Resource: "secrets"}, "app", "db", ObjectOptions{Clean: clean})
+		if err != nil {
+			t.Fatalf("clean=%v: %v", clean, err)
+		}
+
+		for _, field := range []string{"data", "stringData"} {
+			values, _, _ := unstructured.NestedMap(obj.Object, field)
+			if len(values) == 0 {
+				t.Errorf("clean=%v: %s missing", clean, field)
+			}
+			for k, v := range values {
+				if v != MaskedValue {
+					t.Errorf("clean=%v: %s.%s = %v, want masked", clean, field, k, v)
+				}
+			}
+		}
+
+		ann := obj.GetAnnotations()
+		if v, ok := ann[lastAppliedAnnotation]; ok && v != MaskedValue {
+			t.Errorf("clean=%v: last-applied annotation not masked: %q", clean, v)
+		}
+		if ann["team"] != "payments" {
+			t.Errorf("clean=%v: other annotations lost: %v", clean, ann)
+		}
+		if out := obj.Object; strings.Contains(toString(out), "hunter2") || strings.Contains(toString(out), "s3cr3t") {
+			t.Errorf("clean=%v: secret value leaked: %v", clean, out)
+		}
+	}
+}
+
+func TestGetObjectLeavesConfigMaps(t *testing.T) {
+	cm := &v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "app"},
+		Data:       map[string]string{"mode": "fast"},
+	}
+	cl := fakeCluster(coreTypes, cm)
+
+	obj, err := GetObject(context.Background(), cl, schema.GroupVersionResource{Resource: "configmaps"}, "app", "settings", ObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := unstructured.NestedString(obj.Object, "data", "mode"); v != "fast" {
+		t.Errorf("data.mode = %q, want fast", v)
+	}
+}
+
+func toString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,556 @@
+package k8s
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Limits of the cluster overview. Warning events are listed in pages of
+// overviewEventPage, and counting stops after overviewMaxEvents.
+const (
+	OverviewTTL            = 10 * time.Second
+	overviewComputeTimeout = 30 * time.Second
+	overviewEventWindow    = time.Hour
+	overviewEventPage      = 500
+	overviewMaxEvents      = 5000
+	overviewMaxItems       = 20
+)
+
+// Overview is the payload of /api/overview. Sections that could not be
+// computed (RBAC, metrics-server missing) are left empty and explained in
+// Errors.
+type Overview struct {
+	Cluster     string            `json:"cluster"`
+	GeneratedAt string            `json:"generatedAt"`
+	Nodes       NodeCounts        `json:"nodes"`
+	Pods        PodCounts         `json:"pods"`
+	Workloads   WorkloadCounts    `json:"workloads"`
+	Jobs        JobCounts         `json:"jobs"`
+	Events      EventCounts       `json:"events"`
+	Capacity    CapacityTotals    `json:"capacity"`
+	Errors      map[string]string `json:"errors,omitempty"`
+}
+
+// NodeCounts counts nodes by readiness.
+type NodeCounts struct {
+	Total         int `json:"total"`
+	Ready         int `json:"ready"`
+	NotReady      int `json:"notReady"`
+	Unschedulable int `json:"unschedulable"`
+}
+
+// PodCounts counts pods by phase and by common failure, and lists the first
+// problem pods.
+type PodCounts struct {
+	Total            int            `json:"total"`
+	ByPhase          map[string]int `json:"byPhase"`
+	Pending          int            `json:"pending"`
+	CrashLoopBackOff int            `json:"crashLoopBackOff"`
+	ImagePullBackOff int            `json:"imagePullBackOff"`
+	Problems         []ObjectIssue  `json:"problems"`
+}
+
+// WorkloadCounts counts deployments, statefulsets and daemonsets, and lists
+// those below their desired replicas.
+type WorkloadCounts struct {
+	Total    int           `json:"total"`
+	Degraded int           `json:"degraded"`
+	Items    []ObjectIssue `json:"items"`
+}
+
+// JobCounts counts jobs by state and lists the most recent failures.
+type JobCounts struct {
+	Total     int           `json:"total"`
+	Active    int           `json:"active"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Items     []ObjectIssue `json:"items"`
+}
+
+// EventCounts counts Warning events seen in the last hour and lists the
+// latest. Truncated is set when the cluster has more Warning events than
+// the overview reads, making Warnings a lower bound.
+type EventCounts struct {
+	Warnings  int             `json:"warnings"`
+	Recent    []OverviewEvent `json:"recent"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// ObjectIssue names an object and what is wrong with it.
+type ObjectIssue struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+	Desired   *int32 `json:"desired,omitempty"`
+	Ready     *int32 `json:"ready,omitempty"`
+}
+
+// OverviewEvent is one recent Warning event.
+type OverviewEvent struct {
+	Namespace string `json:"namespace"`
+	Object    string `json:"object"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+	Count     int32  `json:"count"`
+	LastSeen  string `json:"lastSeen"`
+}
+
+// CapacityTotals sums node capacity and allocatable, the requests and
+// limits of scheduled pods, and current usage (nil without metrics-server).
+// CPU is in millicores, memory in bytes.
+type CapacityTotals struct {
+	CPU    ResourceTotals `json:"cpu"`
+	Memory ResourceTotals `json:"memory"`
+}
+
+// ResourceTotals is one resource of CapacityTotals.
+type ResourceTotals struct {
+	Capacity    int64  `json:"capacity"`
+	Allocatable int64  `json:"allocatable"`
+	Requests    int64  `json:"requests"`
+	Limits      int64  `json:"limits"`
+	Usage       *int64 `json:"usage"`
+}
+
+type overviewEntry struct {
+	mu       sync.Mutex
+	overview *Overview
+	expires  time.Time
+	// flight is the computation in progress, if any.
+	flight *overviewFlight
+}
+
+// overviewFlight is one computation of an overview; done is closed once o
+// and err are set.
+type overviewFlight struct {
+	done chan struct{}
+	o    *Overview
+	err  error
+}
+
+var (
+	overviewMu    sync.Mutex
+	overviewCache = map[string]*overviewEntry{}
+)
+
+// GetOverview returns the cluster overview, computing it at most once per
+// OverviewTTL; concurrent callers wait for the same computation. The
+// computation is detached from ctx and bound by overviewComputeTimeout, so
+// a caller that gives up neither cancels it for the others nor holds them
+// up.
+func GetOverview(ctx context.Context, cl *Cluster) (*Overview, error) {
+	overviewMu.Lock()
+	entry := overviewCache[cl.Name]
+	if entry == nil {
+		entry = &overviewEntry{}
+		overviewCache[cl.Name] = entry
+	}
+	overviewMu.Unlock()
+
+	entry.mu.Lock()
+	if entry.overview != nil && time.Now().Before(entry.expires) {
+		o := entry.overview
+		entry.mu.Unlock()
+		return o, nil
+	}
+	f := entry.flight
+	if f == nil {
+		f = &overviewFlight{done: make(chan struct{})}
+		entry.flight = f
+		go entry.compute(context.WithoutCancel(ctx), cl, f)
+	}
+	entry.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.o, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (entry *overviewEntry) compute(ctx context.Context, cl *Cluster, f *overviewFlight) {
+	ctx, cancel := context.WithTimeout(ctx, overviewComputeTimeout)
+	defer cancel()
+	f.o, f.err = computeOverview(ctx, cl)
+
+	entry.mu.Lock()
+	if f.err == nil {
+		entry.overview, entry.expires = f.o, time.Now().Add(OverviewTTL)
+	}
+	entry.flight = nil
+	entry.mu.Unlock()
+	close(f.done)
+}
+
+// computeOverview runs every section concurrently. It fails only when no
+// section could be computed.
+func computeOverview(ctx context.Context, cl *Cluster) (*Overview, error) {
+	o := &Overview{
+		Cluster:     cl.Name,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Pods:        PodCounts{ByPhase: map[string]int{}, Problems: []ObjectIssue{}},
+		Workloads:   WorkloadCounts{Items: []ObjectIssue{}},
+		Jobs:        JobCounts{Items: []ObjectIssue{}},
+		Events:      EventCounts{Recent: []OverviewEvent{}},
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		errs     = map[string]string{}
+		firstErr error
+		sections int
+		nodes    []*v1.Node
+		pods     []*v1.Pod
+	)
+	run := func(section string, fn func() error) {
+		sections++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				mu.Lock()
+				errs[section] = err.Error()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	run("nodes", func() (err error) {
+		nodes, err = listCached(ctx, cl, "nodes", func(ctx context.Context) ([]*v1.Node, error) {
+			l, err := cl.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			return pointers(l.Items), nil
+		})
+		return err
+	})
+	run("pods", func() (err error) {
+		pods, err = listPods(ctx, cl, "")
+		return err
+	})
+	run("workloads", func() error { return o.countWorkloads(ctx, cl) })
+	run("jobs", func() error { return o.countJobs(ctx, cl) })
+	run("events", func() error { return o.countEvents(ctx, cl) })
+	run("usage", func() error {
+		list, err := fetchNodeMetrics(ctx, cl)
+		if err != nil {
+			return err
+		}
+		var cpu, mem int64
+		for _, m := range list.Items {
+			cpu += m.Usage.Cpu().MilliValue()
+			mem += m.Usage.Memory().Value()
+		}
+		o.Capacity.CPU.Usage, o.Capacity.Memory.Usage = &cpu, &mem
+		return nil
+	})
+	wg.Wait()
+
+	if len(errs) == sections {
+		return nil, firstErr
+	}
+	if len(errs) > 0 {
+		o.Errors = errs
+	}
+	o.countNodes(nodes)
+	o.countPods(pods)
+	return o, nil
+}
+
+func (o *Overview) countNodes(nodes []*v1.Node) {
+	for _, n := range nodes {
+		o.Nodes.Total++
+		if nodeReady(n) {
+			o.Nodes.Ready++
+		} else {
+			o.Nodes.NotReady++
+		}
+		if n.Spec.Unschedulable {
+			o.Nodes.Unschedulable++
+		}
+		o.Capacity.CPU.Capacity += n.Status.Capacity.Cpu().MilliValue()
+		o.Capacity.Memory.Capacity += n.Status.Capacity.Memory().Value()
+		o.Capacity.CPU.Allocatable += n.Status.Allocatable.Cpu().MilliValue()
+		o.Capacity.Memory.Allocatable += n.Status.Allocatable.Memory().Value()
+	}
+}
+
+func (o *Overview) countPods(pods []*v1.Pod) {
+	sortByNamespaceName(pods)
+	for _, p := range pods {
+		o.Pods.Total++
+		o.Pods.ByPhase[string(p.Status.Phase)]++
+
+		reason := ""
+		if p.Status.Phase == v1.PodPending {
+			o.Pods.Pending++
+			reason = "Pending"
+		}
+		statuses := append(append([]v1.ContainerStatus{}, p.Status.InitContainerStatuses...), p.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if cs.State.Waiting == nil {
+				continue
+			}
+			switch cs.State.Waiting.Reason {
+			case "CrashLoopBackOff":
+				o.Pods.CrashLoopBackOff++
+				reason = "CrashLoopBackOff"
+			case "ImagePullBackOff", "ErrImagePull":
+				o.Pods.ImagePullBackOff++
+				reason = cs.State.Waiting.Reason
+			default:
+				continue
+			}
+			break
+		}
+		if p.Status.Phase == v1.PodFailed {
+			reason = firstNonEmpty(p.Status.Reason, "Failed")
+		}
+		if reason != "" && len(o.Pods.Problems) < overviewMaxItems {
+			o.Pods.Problems = append(o.Pods.Problems, ObjectIssue{Kind: "Pod", Namespace: p.Namespace, Name: p.Name, Reason: reason})
+		}
+
+		if p.Spec.NodeName == "" || p.Status.Phase == v1.PodSucceeded || p.Status.Phase == v1.PodFailed {
+			continue
+		}
+		for _, ct := range p.Spec.Containers {
+			o.Capacity.CPU.Requests += ct.Resources.Requests.Cpu().MilliValue()
+			o.Capacity.Memory.Requests += ct.Resources.Requests.Memory().Value()
+			o.Capacity.CPU.Limits += ct.Resources.Limits.Cpu().MilliValue()
+			o.Capacity.Memory.Limits += ct.Resources.Limits.Memory().Value()
+		}
+	}
+}
+
+// countWorkloads finds deployments, statefulsets and daemonsets whose
+// available/ready replicas are below the desired count. The counts are only
+// set once all three types have been listed.
+func (o *Overview) countWorkloads(ctx context.Context, cl *Cluster) error {
+	apps := cl.Clientset.AppsV1()
+	total := 0
+	var issues []ObjectIssue
+	check := func(kind, ns, name string, desired, ready int32) {
+		total++
+		if ready < desired {
+			issues = append(issues, ObjectIssue{Kind: kind, Namespace: ns, Name: name, Reason: "NotAtDesiredReplicas", Desired: &desired, Ready: &ready})
+		}
+	}
+
+	deployments, err := listCached(ctx, cl, "deployments", func(ctx context.Context) ([]*appsv1.Deployment, error) {
+		l, err := apps.Deployments("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return pointers(l.Items), nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments {
+		desired := int32(1)
+		if d.Spec.Replicas != nil {
+			desired = *d.Spec.Replicas
+		}
+		check("Deployment", d.Namespace, d.Name, desired, d.Status.AvailableReplicas)
+	}
+
+	statefulsets, err := listCached(ctx, cl, "statefulsets", func(ctx context.Context) ([]*appsv1.StatefulSet, error) {
+		l, err := apps.StatefulSets("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return pointers(l.Items), nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, s := range statefulsets {
+		desired := int32(1)
+		if s.Spec.Replicas != nil {
+			desired = *s.Spec.Replicas
+		}
+		check("StatefulSet", s.Namespace, s.Name, desired, s.Status.ReadyReplicas)
+	}
+
+	daemonsets, err := listCached(ctx, cl, "daemonsets", func(ctx context.Context) ([]*appsv1.DaemonSet, error) {
+		l, err := apps.DaemonSets("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return pointers(l.Items), nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, d := range daemonsets {
+		check("DaemonSet", d.Namespace, d.Name, d.Status.DesiredNumberScheduled, d.Status.NumberAvailable)
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Namespace != issues[j].Namespace {
+			return issues[i].Namespace < issues[j].Namespace
+		}
+		return issues[i].Name < issues[j].Name
+	})
+	o.Workloads.Total = total
+	o.Workloads.Degraded = len(issues)
+	if len(issues) > overviewMaxItems {
+		issues = issues[:overviewMaxItems]
+	}
+	o.Workloads.Items = append(o.Workloads.Items, issues...)
+	return nil
+}
+
+// countJobs counts jobs by state and lists the latest failed ones.
+func (o *Overview) countJobs(ctx context.Context, cl *Cluster) error {
+	jobs, err := listCached(ctx, cl, "jobs", func(ctx context.Context) ([]*batchv1.Job, error) {
+		l, err := cl.Clientset.BatchV1().Jobs("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return pointers(l.Items), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var failed []*batchv1.Job
+	for _, j := range jobs {
+		o.Jobs.Total++
+		switch {
+		case jobCondition(j, batchv1.JobFailed) != nil:
+			o.Jobs.Failed++
+			failed = append(failed, j)
+		case jobCondition(j, batchv1.JobComplete) != nil:
+			o.Jobs.Succeeded++
+		default:
+			o.Jobs.Active++
+		}
+	}
+
+	sort.Slice(failed, func(i, j int) bool {
+		return jobCondition(failed[i], batchv1.JobFailed).LastTransitionTime.After(jobCondition(failed[j], batchv1.JobFailed).LastTransitionTime.Time)
+	})
+	for _, j := range failed {
+		if len(o.Jobs.Items) == overviewMaxItems {
+			break
+		}
+		o.Jobs.Items = append(o.Jobs.Items, ObjectIssue{
+			Kind:      "Job",
+			Namespace: j.Namespace,
+			Name:      j.Name,
+			Reason:    firstNonEmpty(jobCondition(j, batchv1.JobFailed).Reason, "Failed"),
+		})
+	}
+	return nil
+}
+
+// countEvents counts the Warning events of the last hour and keeps the
+// latest. Events are listed page by page, reading at most overviewMaxEvents.
+func (o *Overview) countEvents(ctx context.Context, cl *Cluster) error {
+	cutoff := time.Now().Add(-overviewEventWindow)
+	var recent []v1.Event
+	opts := metav1.ListOptions{FieldSelector: "type=" + v1.EventTypeWarning, Limit: overviewEventPage}
+	for read := 0; ; {
+		list, err := cl.Clientset.CoreV1().Events("").List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, ev := range list.Items {
+			if eventTime(ev).After(cutoff) {
+				recent = append(recent, ev)
+			}
+		}
+		read += len(list.Items)
+		if list.Continue == "" {
+			break
+		}
+		if read >= overviewMaxEvents {
+			o.Events.Truncated = true
+			break
+		}
+		opts.Continue = list.Continue
+	}
+	sort.Slice(recent, func(i, j int) bool { return eventTime(recent[i]).After(eventTime(recent[j])) })
+
+	o.Events.Warnings = len(recent)
+	for _, ev := range recent {
+		if len(o.Events.Recent) == overviewMaxItems {
+			break
+		}
+		o.Events.Recent = append(o.Events.Recent, OverviewEvent{
+			Namespace: ev.Namespace,
+			Object:    ev.InvolvedObject.Kind + "/" + ev.InvolvedObject.Name,
+			Reason:    ev.Reason,
+			Message:   ev.Message,
+			Count:     ev.Count,
+			LastSeen:  eventTime(ev).UTC().Format(time.RFC3339),
+		})
+	}
+	return nil
+}
+
+// listCached lists every object of rtype from the informer cache once it
+// has synced, and with direct until then.
+func listCached[T runtime.Object](ctx context.Context, cl *Cluster, rtype string, direct func(context.Context) ([]T, error)) ([]T, error) {
+	if objs, ok := cl.ResourceCache().List(rtype, ""); ok {
+		out := make([]T, 0, len(objs))
+		for _, obj := range objs {
+			if t, ok := obj.(T); ok {
+				out = append(out, t)
+			}
+		}
+		return out, nil
+	}
+	return direct(ctx)
+}
+
+func pointers[T any](items []T) []*T {
+	out := make([]*T, len(items))
+	for i := range items {
+		out[i] = &items[i]
+	}
+	return out
+}
+
+func sortByNamespaceName(pods []*v1.Pod) {
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+}
+
+func nodeReady(n *v1.Node) bool {
+	for _, c := range n.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func jobCondition(j *batchv1.Job, t batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range j.Status.Conditions {
+		if c := &j.Status.Conditions[i]; c.Type == t && c.Status == v1.ConditionTrue {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testPod(ns, name string, phase v1.PodPhase, waiting string) *v1.Pod {
+	p := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+		Spec: v1.PodSpec{
+			NodeName: "node-1",
+			Containers: []v1.Container{{
+				Name: "app",
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("64Mi")},
+					Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+				},
+			}},
+		},
+		Status: v1.PodStatus{Phase: phase},
+	}
+	if waiting != "" {
+		p.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "app", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: waiting}}}}
+	}
+	return p
+}
+
+func TestCountPods(t *testing.T) {
+	pending := testPod("b", "pending", v1.PodPending, "")
+	pending.Spec.NodeName = ""
+	pods := []*v1.Pod{
+		testPod("b", "ok", v1.PodRunning, ""),
+		testPod("a", "crash", v1.PodRunning, "CrashLoopBackOff"),
+		testPod("a", "pull", v1.PodPending, "ErrImagePull"),
+		pending,
+		testPod("c", "done", v1.PodSucceeded, ""),
+		testPod("c", "evicted", v1.PodFailed, ""),
+	}
+	pods[5].Status.Reason = "Evicted"
+
+	o := &Overview{Pods: PodCounts{ByPhase: map[string]int{}}}
+	o.countPods(pods)
+
+	p := o.Pods
+	if p.Total != 6 || p.Pending != 2 || p.CrashLoopBackOff != 1 || p.ImagePullBackOff != 1 {
+		t.Errorf("counts = %+v", p)
+	}
+	if p.ByPhase["Running"] != 2 || p.ByPhase["Pending"] != 2 || p.ByPhase["Succeeded"] != 1 || p.ByPhase["Failed"] != 1 {
+		t.Errorf("byPhase = %v", p.ByPhase)
+	}
+	want := []string{"a/crash CrashLoopBackOff", "a/pull ErrImagePull", "b/pending Pending", "c/evicted Evicted"}
+	if len(p.Problems) != len(want) {
+		t.Fatalf("problems = %+v", p.Problems)
+	}
+	for i, w := range want {
+		if got := p.Problems[i].Namespace + "/" + p.Problems[i].Name + " " + p.Problems[i].Reason; got != w {
+			t.Errorf("problem %d = %q, want %q", i, got, w)
+		}
+	}
+
+	// Only scheduled pods that haven't finished count towards requests:
+	// ok, crash and pull.
+	if cpu := o.Capacity.CPU; cpu.Requests != 300 || cpu.Limits != 1500 {
+		t.Errorf("cpu = %+v", cpu)
+	}
+	if mem := o.Capacity.Memory.Requests; mem != 3*64<<20 {
+		t.Errorf("memory requests = %d", mem)
+	}
+}
+
+func TestCountWorkloads(t *testing.T) {
+	replicas := func(n int32) *int32 { return &n }
+	objs := []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "web"}, Spec: appsv1.DeploymentSpec{Replicas: replicas(3)}, Status: appsv1.DeploymentStatus{AvailableReplicas: 1}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "api"}, Status: appsv1.DeploymentStatus{AvailableReplicas: 1}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "db"}, Spec: appsv1.StatefulSetSpec{Replicas: replicas(2)}, Status: appsv1.StatefulSetStatus{ReadyReplicas: 2}},
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "agent"}, Status: appsv1.DaemonSetStatus{DesiredNumberScheduled: 4, NumberAvailable: 3}},
+	}
+
+	o := &Overview{Workloads: WorkloadCounts{Items: []ObjectIssue{}}}
+	if err := o.countWorkloads(context.Background(), fakeCluster(nil, objs...)); err != nil {
+		t.Fatal(err)
+	}
+	w := o.Workloads
+	if w.Total != 4 || w.Degraded != 2 || len(w.Items) != 2 {
+		t.Fatalf("workloads = %+v", w)
+	}
+	if it := w.Items[0]; it.Name != "web" || *it.Desired != 3 || *it.Ready != 1 {
+		t.Errorf("first issue = %+v", it)
+	}
+	if it := w.Items[1]; it.Kind != "DaemonSet" || it.Name != "agent" {
+		t.Errorf("second issue = %+v", it)
+	}
+
+	// A failing section leaves no partial counts behind.
+	cl := fakeCluster(nil, objs...)
+	cl.Clientset.(*fake.Clientset).PrependReactor("list", "daemonsets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	o = &Overview{Workloads: WorkloadCounts{Items: []ObjectIssue{}}}
+	if err := o.countWorkloads(context.Background(), cl); err == nil {
+		t.Fatal("want an error")
+	}
+	if o.Workloads.Total != 0 || len(o.Workloads.Items) != 0 {
+		t.Errorf("partial workloads = %+v", o.Workloads)
+	}
+}
+
+func TestGetOverviewOutlivesCaller(t *testing.T) {
+	cl := fakeCluster(nil, testPod("a", "web", v1.PodRunning, ""))
+	cl.Name = "overview-detached"
+	release := make(chan struct{})
+	cl.Clientset.(*fake.Clientset).PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetOverview(ctx, cl); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller err = %v", err)
+	}
+	close(release)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	o, err := GetOverview(ctx, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Pods.Total != 1 || o.Errors["nodes"] != "" {
+		t.Errorf("overview = %+v", o)
+	}
+}
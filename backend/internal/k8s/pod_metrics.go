@@ -10,57 +10,88 @@ import (
 	"k8s.io/client-go/rest"
 )
 
-// GetPodMetrics hits: /apis/metrics.k8s.io/v1beta1/namespaces/{ns}/pods/{pod}
-func GetPodMetrics(ns, pod string) ([]byte, error) {
-	cfg := RestConfig()
+// metricsClient returns the cluster's metrics.k8s.io REST client, built once
+// and shared by every metrics request.
+func (cl *Cluster) metricsClient() (rest.Interface, error) {
+	cl.metricsOnce.Do(func() {
+		// Create scheme and serializer for metrics API
+		scheme := runtime.NewScheme()
+		codecs := serializer.NewCodecFactory(scheme)
 
-	// Create scheme and serializer for metrics API
-	scheme := runtime.NewScheme()
-	codecs := serializer.NewCodecFactory(scheme)
+		// Create a new config for metrics API
+		metricsCfg := rest.CopyConfig(cl.Config)
+		metricsCfg.GroupVersion = &schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
+		metricsCfg.APIPath = "/apis"
+		metricsCfg.NegotiatedSerializer = codecs.WithoutConversion()
 
-	// Create a new config for metrics API
-	metricsCfg := rest.CopyConfig(cfg)
-	metricsCfg.GroupVersion = &schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
-	metricsCfg.APIPath = "/apis"
-	metricsCfg.NegotiatedSerializer = codecs.WithoutConversion()
+		cl.metricsRC, cl.metricsErr = rest.RESTClientFor(metricsCfg)
+		if cl.metricsErr != nil {
+			cl.metricsErr = fmt.Errorf("failed to create REST client: %v", cl.metricsErr)
+		}
+	})
+	return cl.metricsRC, cl.metricsErr
+}
+
+// metricsServer is the default MetricsProvider, reading metrics.k8s.io.
+type metricsServer struct{}
 
-	rc, err := rest.RESTClientFor(metricsCfg)
+// PodMetrics hits: /apis/metrics.k8s.io/v1beta1/namespaces/{ns}/pods/{pod}
+func (metricsServer) PodMetrics(ctx context.Context, cl *Cluster, ns, pod string) ([]byte, error) {
+	rc, err := cl.metricsClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create REST client: %v", err)
+		return nil, err
 	}
 
 	result := rc.Get().
 		Namespace(ns).
 		Resource("pods").
 		Name(pod).
-		Do(context.TODO())
+		Do(ctx)
 
 	return result.Raw()
 }
 
-// GetNodeMetrics hits: /apis/metrics.k8s.io/v1beta1/nodes/{node}
-func GetNodeMetrics(nodeName string) ([]byte, error) {
-	cfg := RestConfig()
-
-	// Create scheme and serializer for metrics API
-	scheme := runtime.NewScheme()
-	codecs := serializer.NewCodecFactory(scheme)
-
-	// Create a new config for metrics API
-	metricsCfg := rest.CopyConfig(cfg)
-	metricsCfg.GroupVersion = &schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
-	metricsCfg.APIPath = "/apis"
-	metricsCfg.NegotiatedSerializer = codecs.WithoutConversion()
-
-	rc, err := rest.RESTClientFor(metricsCfg)
+// NodeMetrics hits: /apis/metrics.k8s.io/v1beta1/nodes/{node}
+func (metricsServer) NodeMetrics(ctx context.Context, cl *Cluster, nodeName string) ([]byte, error) {
+	rc, err := cl.metricsClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create REST client: %v", err)
+		return nil, err
 	}
 
 	result := rc.Get().
 		Resource("nodes").
 		Name(nodeName).
-		Do(context.TODO())
+		Do(ctx)
 
 	return result.Raw()
 }
+
+// PodMetricsList hits: /apis/metrics.k8s.io/v1beta1/namespaces/{ns}/pods
+func (metricsServer) PodMetricsList(ctx context.Context, cl *Cluster, ns string) ([]byte, error) {
+	rc, err := cl.metricsClient()
+	if err != nil {
+		return nil, err
+	}
+	return rc.Get().Namespace(ns).Resource("pods").Do(ctx).Raw()
+}
+
+// NodeMetricsList hits: /apis/metrics.k8s.io/v1beta1/nodes
+func (metricsServer) NodeMetricsList(ctx context.Context, cl *Cluster) ([]byte, error) {
+	rc, err := cl.metricsClient()
+	if err != nil {
+		return nil, err
+	}
+	return rc.Get().Resource("nodes").Do(ctx).Raw()
+}
+
+// GetPodMetrics returns a pod's current usage as a metrics.k8s.io PodMetrics
+// object, from the cluster's metrics provider.
+func GetPodMetrics(ctx context.Context, cl *Cluster, ns, pod string) ([]byte, error) {
+	return metricsProviderFor(cl).PodMetrics(ctx, cl, ns, pod)
+}
+
+// GetNodeMetrics returns a node's current usage as a metrics.k8s.io
+// NodeMetrics object, from the cluster's metrics provider.
+func GetNodeMetrics(ctx context.Context, cl *Cluster, nodeName string) ([]byte, error) {
+	return metricsProviderFor(cl).NodeMetrics(ctx, cl, nodeName)
+}
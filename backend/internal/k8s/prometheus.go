@@ -0,0 +1,511 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Default PromQL templates of the Prometheus provider. .Selector is the
+// label matcher of the pod, node or workload pods (including the cluster
+// label when PrometheusConfig.ClusterLabel is set), .By the grouping labels
+// ("container", "namespace, pod, container", the node label, or empty for a
+// total), .Rate the rate() window and .Cluster
+// the webk8s cluster name, for custom templates.
+const (
+	DefaultPrometheusCPUQuery    = `sum by ({{.By}}) (rate(container_cpu_usage_seconds_total{ {{.Selector}}, container!="", container!="POD"}[{{.Rate}}]))`
+	DefaultPrometheusMemoryQuery = `sum by ({{.By}}) (container_memory_working_set_bytes{ {{.Selector}}, container!="", container!="POD"})`
+
+	// DefaultPrometheusNodeLabel is the label carrying the node name of
+	// cAdvisor series as scraped by kube-prometheus.
+	DefaultPrometheusNodeLabel = "node"
+)
+
+// minPromRate is the shortest rate() window used, so that at least a couple
+// of cAdvisor scrapes fall into every window.
+const minPromRate = 2 * time.Minute
+
+// promLabelName matches valid Prometheus label names.
+var promLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// PrometheusConfig configures the Prometheus metrics provider.
+type PrometheusConfig struct {
+	URL string
+
+	// BearerToken, or Username and Password, authenticate every request.
+	BearerToken string
+	Username    string
+	Password    string
+
+	// CPUQuery and MemoryQuery override the default query templates.
+	CPUQuery    string
+	MemoryQuery string
+
+	// ClusterLabel is the label that tells clusters apart in a Prometheus
+	// shared by several of them (e.g. "cluster"); every selector then also
+	// matches it against the webk8s cluster name. Leave it empty when the
+	// server only holds one cluster's metrics.
+	ClusterLabel string
+
+	// NodeLabel is the label holding the node name of the cAdvisor series,
+	// e.g. "instance" or "kubernetes_io_hostname" depending on the scrape
+	// config; empty means DefaultPrometheusNodeLabel.
+	NodeLabel string
+
+	// Client sends the requests; nil uses a client with a 30s timeout.
+	Client *http.Client
+}
+
+// PrometheusProvider reads current and historical usage from the cAdvisor
+// metrics in Prometheus.
+type PrometheusProvider struct {
+	url         string
+	cfg         PrometheusConfig
+	client      *http.Client
+	cpuQuery    *template.Template
+	memoryQuery *template.Template
+}
+
+// NewPrometheusProvider validates cfg and parses its query templates.
+func NewPrometheusProvider(cfg PrometheusConfig) (*PrometheusProvider, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Prometheus URL %q", cfg.URL)
+	}
+	if cfg.ClusterLabel != "" && !promLabelName.MatchString(cfg.ClusterLabel) {
+		return nil, fmt.Errorf("invalid Prometheus cluster label %q", cfg.ClusterLabel)
+	}
+	if cfg.NodeLabel == "" {
+		cfg.NodeLabel = DefaultPrometheusNodeLabel
+	}
+	if !promLabelName.MatchString(cfg.NodeLabel) {
+		return nil, fmt.Errorf("invalid Prometheus node label %q", cfg.NodeLabel)
+	}
+	if cfg.CPUQuery == "" {
+		cfg.CPUQuery = DefaultPrometheusCPUQuery
+	}
+	if cfg.MemoryQuery == "" {
+		cfg.MemoryQuery = DefaultPrometheusMemoryQuery
+	}
+
+	p := &PrometheusProvider{url: strings.TrimSuffix(cfg.URL, "/"), cfg: cfg, client: cfg.Client}
+	if p.client == nil {
+		p.client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if p.cpuQuery, err = template.New("cpu").Option("missingkey=error").Parse(cfg.CPUQuery); err != nil {
+		return nil, fmt.Errorf("invalid Prometheus CPU query: %w", err)
+	}
+	if p.memoryQuery, err = template.New("memory").Option("missingkey=error").Parse(cfg.MemoryQuery); err != nil {
+		return nil, fmt.Errorf("invalid Prometheus memory query: %w", err)
+	}
+	return p, nil
+}
+
+// promQueryData is the data of the query templates.
+type promQueryData struct {
+	Cluster  string
+	Selector string
+	By       string
+	Rate     string
+}
+
+// PodMetrics reports the pod's usage at the latest sample as PodMetrics.
+func (p *PrometheusProvider) PodMetrics(ctx context.Context, cl *Cluster, ns, pod string) ([]byte, error) {
+	data := promQueryData{Cluster: cl.Name, Selector: p.selector(cl, podSelector(ns, []string{pod})), By: "container", Rate: promDuration(minPromRate)}
+	cpu, memory, err := p.instant(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(cpu) == 0 && len(memory) == 0 {
+		return nil, apierrors.NewNotFound(v1.Resource("pods"), pod)
+	}
+
+	out := podMetrics{Timestamp: metav1.Now()}
+	out.Metadata.Name, out.Metadata.Namespace = pod, ns
+	containers := map[string]bool{}
+	for _, s := range append(cpu, memory...) {
+		containers[s.Metric["container"]] = true
+	}
+	for _, name := range sortedKeys(containers) {
+		out.Containers = append(out.Containers, struct {
+			Name  string          `json:"name"`
+			Usage v1.ResourceList `json:"usage"`
+		}{Name: name, Usage: usageList(seriesValue(cpu, name), seriesValue(memory, name))})
+	}
+	return json.Marshal(out)
+}
+
+// NodeMetrics reports the node's usage at the latest sample as NodeMetrics.
+func (p *PrometheusProvider) NodeMetrics(ctx context.Context, cl *Cluster, node string) ([]byte, error) {
+	data := promQueryData{Cluster: cl.Name, Selector: p.selector(cl, p.cfg.NodeLabel+"="+strconv.Quote(node)), Rate: promDuration(minPromRate)}
+	cpu, memory, err := p.instant(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(cpu) == 0 && len(memory) == 0 {
+		return nil, apierrors.NewNotFound(v1.Resource("nodes"), node)
+	}
+
+	out := nodeMetrics{Timestamp: metav1.Now(), Usage: usageList(seriesValue(cpu, ""), seriesValue(memory, ""))}
+	out.Metadata.Name = node
+	return json.Marshal(out)
+}
+
+// PodMetricsList reports the usage of every pod of ns (all namespaces when
+// empty) at the latest sample as a PodMetrics list.
+func (p *PrometheusProvider) PodMetricsList(ctx context.Context, cl *Cluster, ns string) ([]byte, error) {
+	sel := `namespace!=""`
+	if ns != "" {
+		sel = "namespace=" + strconv.Quote(ns)
+	}
+	data := promQueryData{Cluster: cl.Name, Selector: p.selector(cl, sel), By: "namespace, pod, container", Rate: promDuration(minPromRate)}
+	cpu, memory, err := p.instant(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	type podKey struct{ namespace, pod string }
+	byPod := map[podKey]map[string][2]float64{}
+	add := func(series []promSeries, i int) {
+		for _, s := range series {
+			if s.Value == nil || math.IsNaN(s.Value.V) {
+				continue
+			}
+			key := podKey{s.Metric["namespace"], s.Metric["pod"]}
+			if byPod[key] == nil {
+				byPod[key] = map[string][2]float64{}
+			}
+			v := byPod[key][s.Metric["container"]]
+			v[i] = s.Value.V
+			byPod[key][s.Metric["container"]] = v
+		}
+	}
+	add(cpu, 0)
+	add(memory, 1)
+
+	list := podMetricsList{Items: []podMetrics{}}
+	now := metav1.Now()
+	for key, containers := range byPod {
+		m := podMetrics{Timestamp: now}
+		m.Metadata.Name, m.Metadata.Namespace = key.pod, key.namespace
+		for _, name := range sortedKeys(containers) {
+			m.Containers = append(m.Containers, struct {
+				Name  string          `json:"name"`
+				Usage v1.ResourceList `json:"usage"`
+			}{Name: name, Usage: usageList(containers[name][0], containers[name][1])})
+		}
+		list.Items = append(list.Items, m)
+	}
+	return json.Marshal(list)
+}
+
+// NodeMetricsList reports the usage of every node at the latest sample as a
+// NodeMetrics list.
+func (p *PrometheusProvider) NodeMetricsList(ctx context.Context, cl *Cluster) ([]byte, error) {
+	data := promQueryData{Cluster: cl.Name, Selector: p.selector(cl, p.cfg.NodeLabel+`!=""`), By: p.cfg.NodeLabel, Rate: promDuration(minPromRate)}
+	cpu, memory, err := p.instant(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := map[string][2]float64{}
+	for i, series := range [][]promSeries{cpu, memory} {
+		for _, s := range series {
+			if s.Value == nil || math.IsNaN(s.Value.V) {
+				continue
+			}
+			v := usage[s.Metric[p.cfg.NodeLabel]]
+			v[i] = s.Value.V
+			usage[s.Metric[p.cfg.NodeLabel]] = v
+		}
+	}
+
+	list := nodeMetricsList{Items: []nodeMetrics{}}
+	now := metav1.Now()
+	for _, node := range sortedKeys(usage) {
+		m := nodeMetrics{Timestamp: now, Usage: usageList(usage[node][0], usage[node][1])}
+		m.Metadata.Name = node
+		list.Items = append(list.Items, m)
+	}
+	return json.Marshal(list)
+}
+
+// UsageRange runs the CPU and memory queries as range queries. Pods and
+// workloads get one series per container plus a total (Container empty);
+// nodes only the total.
+func (p *PrometheusProvider) UsageRange(ctx context.Context, cl *Cluster, q UsageQuery) ([]MetricsSeries, error) {
+	rate := q.Step
+	if rate < minPromRate {
+		rate = minPromRate
+	}
+	data := promQueryData{Cluster: cl.Name, Rate: promDuration(rate)}
+	switch {
+	case q.Kind == HistoryNode:
+		data.Selector = p.cfg.NodeLabel + "=" + strconv.Quote(q.Name)
+	case q.Kind == HistoryPod:
+		data.Selector, data.By = podSelector(q.Namespace, []string{q.Name}), "container"
+	case slices.Contains(WorkloadKinds, q.Kind):
+		data.Selector, data.By = podSelector(q.Namespace, q.Pods), "container"
+	default:
+		return nil, fmt.Errorf("unsupported metrics kind %q", q.Kind)
+	}
+	data.Selector = p.selector(cl, data.Selector)
+
+	params := url.Values{
+		"start": {strconv.FormatInt(q.Start.Unix(), 10)},
+		"end":   {strconv.FormatInt(q.End.Unix(), 10)},
+		"step":  {promDuration(q.Step)},
+	}
+	cpu, err := p.run(ctx, "/api/v1/query_range", p.cpuQuery, data, params)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := p.run(ctx, "/api/v1/query_range", p.memoryQuery, data, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeUsageSeries(cpu, memory, data.By != ""), nil
+}
+
+// selector adds the cluster label matcher, when configured, to sel.
+func (p *PrometheusProvider) selector(cl *Cluster, sel string) string {
+	if p.cfg.ClusterLabel == "" {
+		return sel
+	}
+	return fmt.Sprintf("%s=%s, %s", p.cfg.ClusterLabel, strconv.Quote(cl.Name), sel)
+}
+
+// instant runs the CPU and memory queries at the current time.
+func (p *PrometheusProvider) instant(ctx context.Context, data promQueryData) (cpu, memory []promSeries, err error) {
+	if cpu, err = p.run(ctx, "/api/v1/query", p.cpuQuery, data, url.Values{}); err != nil {
+		return nil, nil, err
+	}
+	if memory, err = p.run(ctx, "/api/v1/query", p.memoryQuery, data, url.Values{}); err != nil {
+		return nil, nil, err
+	}
+	return cpu, memory, nil
+}
+
+// promResponse is the envelope of the Prometheus HTTP API.
+type promResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string       `json:"resultType"`
+		Result     []promSeries `json:"result"`
+	} `json:"data"`
+}
+
+// promSeries is one vector element (Value) or matrix series (Values).
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  *promSample       `json:"value"`
+	Values []promSample      `json:"values"`
+}
+
+// promSample decodes Prometheus's [<unix seconds>, "<value>"] pairs.
+type promSample struct {
+	T time.Time
+	V float64
+}
+
+func (s *promSample) UnmarshalJSON(b []byte) error {
+	var raw [2]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	var ts float64
+	var val string
+	if err := json.Unmarshal(raw[0], &ts); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw[1], &val); err != nil {
+		return err
+	}
+	v, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return err
+	}
+	sec, frac := math.Modf(ts)
+	s.T, s.V = time.Unix(int64(sec), int64(frac*1e9)), v
+	return nil
+}
+
+// run renders a query template and posts it to the Prometheus API endpoint.
+// Failures are reported as 503s: the query is server configuration, not
+// something the caller can fix.
+func (p *PrometheusProvider) run(ctx context.Context, endpoint string, tmpl *template.Template, data promQueryData, params url.Values) ([]promSeries, error) {
+	var query bytes.Buffer
+	if err := tmpl.Execute(&query, data); err != nil {
+		return nil, fmt.Errorf("failed to render Prometheus %s query: %w", tmpl.Name(), err)
+	}
+	params.Set("query", query.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case p.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.cfg.BearerToken)
+	case p.cfg.Username != "":
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, apierrors.NewServiceUnavailable(fmt.Sprintf("prometheus unreachable: %v", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, apierrors.NewServiceUnavailable(fmt.Sprintf("failed to read prometheus response: %v", err))
+	}
+	var out promResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, apierrors.NewServiceUnavailable(fmt.Sprintf("prometheus returned %s: %s", resp.Status, truncate(string(body), 200)))
+	}
+	if out.Status != "success" {
+		return nil, apierrors.NewServiceUnavailable(fmt.Sprintf("prometheus %s query failed (%s): %s", tmpl.Name(), out.ErrorType, out.Error))
+	}
+	return out.Data.Result, nil
+}
+
+// podSelector matches the named pods of a namespace.
+func podSelector(ns string, pods []string) string {
+	if len(pods) == 1 {
+		return fmt.Sprintf("namespace=%s, pod=%s", strconv.Quote(ns), strconv.Quote(pods[0]))
+	}
+	quoted := make([]string, len(pods))
+	for i, name := range pods {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return fmt.Sprintf("namespace=%s, pod=~%s", strconv.Quote(ns), strconv.Quote(strings.Join(quoted, "|")))
+}
+
+// promDuration formats d in whole seconds, as PromQL durations and the
+// query_range step accept.
+func promDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10) + "s"
+}
+
+// seriesValue returns the instant value of the series for container (the
+// only series when the query isn't grouped).
+func seriesValue(series []promSeries, container string) float64 {
+	for _, s := range series {
+		if s.Metric["container"] == container && s.Value != nil && !math.IsNaN(s.Value.V) {
+			return s.Value.V
+		}
+	}
+	return 0
+}
+
+// usageList converts CPU cores and memory bytes into a ResourceList.
+func usageList(cores, bytes float64) v1.ResourceList {
+	return v1.ResourceList{
+		v1.ResourceCPU:    *resource.NewMilliQuantity(int64(math.Round(cores*1000)), resource.DecimalSI),
+		v1.ResourceMemory: *resource.NewQuantity(int64(bytes), resource.BinarySI),
+	}
+}
+
+// mergeUsageSeries joins the CPU and memory matrices by container and
+// timestamp, adding a per-timestamp total when the queries were grouped by
+// container.
+func mergeUsageSeries(cpu, memory []promSeries, withTotal bool) []MetricsSeries {
+	points := map[string]map[int64]*MetricsPoint{}
+	at := func(container string, t time.Time) *MetricsPoint {
+		byTime := points[container]
+		if byTime == nil {
+			byTime = map[int64]*MetricsPoint{}
+			points[container] = byTime
+		}
+		pt := byTime[t.Unix()]
+		if pt == nil {
+			pt = &MetricsPoint{Time: t.UTC().Format(time.RFC3339)}
+			byTime[t.Unix()] = pt
+		}
+		return pt
+	}
+
+	for _, s := range cpu {
+		for _, v := range s.Values {
+			if math.IsNaN(v.V) {
+				continue
+			}
+			cores := int64(math.Round(v.V * 1000))
+			at(s.Metric["container"], v.T).CPU += cores
+			if withTotal {
+				at("", v.T).CPU += cores
+			}
+		}
+	}
+	for _, s := range memory {
+		for _, v := range s.Values {
+			if math.IsNaN(v.V) {
+				continue
+			}
+			at(s.Metric["container"], v.T).Memory += int64(v.V)
+			if withTotal {
+				at("", v.T).Memory += int64(v.V)
+			}
+		}
+	}
+
+	out := make([]MetricsSeries, 0, len(points))
+	for container, byTime := range points {
+		times := make([]int64, 0, len(byTime))
+		for t := range byTime {
+			times = append(times, t)
+		}
+		slices.Sort(times)
+
+		series := MetricsSeries{Container: container, Points: make([]MetricsPoint, 0, len(times))}
+		for _, t := range times {
+			series.Points = append(series.Points, *byTime[t])
+		}
+		out = append(out, series)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Container < out[j].Container })
+	return out
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
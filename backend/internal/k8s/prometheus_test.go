@@ -0,0 +1,414 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// fakePrometheus records the requests it gets and answers every query with
+// respond's body.
+type fakePrometheus struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []promRequest
+}
+
+type promRequest struct {
+	Path          string
+	Query         string
+	Start, End    string
+	Step          string
+	Authorization string
+}
+
+func newFakePrometheus(t *testing.T, respond func(query string) (int, string)) *fakePrometheus {
+	f := &fakePrometheus{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("bad form: %v", err)
+		}
+		req := promRequest{
+			Path:          r.URL.Path,
+			Query:         r.PostForm.Get("query"),
+			Start:         r.PostForm.Get("start"),
+			End:           r.PostForm.Get("end"),
+			Step:          r.PostForm.Get("step"),
+			Authorization: r.Header.Get("Authorization"),
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		f.mu.Unlock()
+
+		code, body := respond(req.Query)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakePrometheus) provider(t *testing.T, cfg PrometheusConfig) *PrometheusProvider {
+	cfg.URL = f.URL + "/"
+	cfg.Client = f.Client()
+	p, err := NewPrometheusProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// promVector and promMatrix build successful query responses.
+func promVector(samples map[string]float64) string {
+	var result []map[string]any
+	for container, v := range samples {
+		metric := map[string]string{}
+		if container != "" {
+			metric["container"] = container
+		}
+		result = append(result, map[string]any{"metric": metric, "value": []any{1700000000, jsonFloat(v)}})
+	}
+	return promEnvelope("vector", result)
+}
+
+func promMatrix(series map[string][]float64, start int64, step int64) string {
+	var result []map[string]any
+	for container, vals := range series {
+		var values [][]any
+		for i, v := range vals {
+			values = append(values, []any{start + int64(i)*step, jsonFloat(v)})
+		}
+		result = append(result, map[string]any{"metric": map[string]string{"container": container}, "values": values})
+	}
+	return promEnvelope("matrix", result)
+}
+
+func promEnvelope(resultType string, result []map[string]any) string {
+	if result == nil {
+		result = []map[string]any{}
+	}
+	b, _ := json.Marshal(map[string]any{
+		"status": "success",
+		"data":   map[string]any{"resultType": resultType, "result": result},
+	})
+	return string(b)
+}
+
+func jsonFloat(v float64) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestPrometheusQueryTemplating(t *testing.T) {
+	f := newFakePrometheus(t, func(string) (int, string) {
+		return 200, promVector(map[string]float64{"app": 0.25})
+	})
+	cl := &Cluster{Name: "prod"}
+
+	tests := []struct {
+		name   string
+		cfg    PrometheusConfig
+		call   func(p *PrometheusProvider) error
+		want   []string
+		auth   string
+		wantNo []string
+	}{
+		{
+			name: "pod default templates",
+			call: func(p *PrometheusProvider) error {
+				_, err := p.PodMetrics(context.Background(), cl, "shop", "web-1")
+				return err
+			},
+			want: []string{
+				`sum by (container) (rate(container_cpu_usage_seconds_total{ namespace="shop", pod="web-1", container!="", container!="POD"}[120s]))`,
+				`sum by (container) (container_memory_working_set_bytes{ namespace="shop", pod="web-1", container!="", container!="POD"})`,
+			},
+			wantNo: []string{"prod"},
+		},
+		{
+			name: "node with cluster label and bearer token",
+			cfg:  PrometheusConfig{ClusterLabel: "cluster", BearerToken: "tok"},
+			call: func(p *PrometheusProvider) error {
+				_, err := p.NodeMetrics(context.Background(), cl, "node-a")
+				return err
+			},
+			want: []string{
+				`sum by () (rate(container_cpu_usage_seconds_total{ cluster="prod", node="node-a", container!="", container!="POD"}[120s]))`,
+				`sum by () (container_memory_working_set_bytes{ cluster="prod", node="node-a", container!="", container!="POD"})`,
+			},
+			auth: "Bearer tok",
+		},
+		{
+			name: "node list with a custom node label",
+			cfg:  PrometheusConfig{NodeLabel: "kubernetes_io_hostname"},
+			call: func(p *PrometheusProvider) error {
+				_, err := p.NodeMetricsList(context.Background(), cl)
+				return err
+			},
+			want: []string{
+				`sum by (kubernetes_io_hostname) (rate(container_cpu_usage_seconds_total{ kubernetes_io_hostname!="", container!="", container!="POD"}[120s]))`,
+				`sum by (kubernetes_io_hostname) (container_memory_working_set_bytes{ kubernetes_io_hostname!="", container!="", container!="POD"})`,
+			},
+			wantNo: []string{"node"},
+		},
+		{
+			name: "custom templates",
+			cfg: PrometheusConfig{
+				CPUQuery:    `cpu{ {{.Selector}}, k8s="{{.Cluster}}"}[{{.Rate}}] by {{.By}}`,
+				MemoryQuery: `mem{ {{.Selector}} }`,
+			},
+			call: func(p *PrometheusProvider) error {
+				_, err := p.UsageRange(context.Background(), cl, UsageQuery{
+					Kind: "deployments", Namespace: "shop", Name: "web", Pods: []string{"web-1", "web.2"},
+					Start: time.Unix(1000, 0), End: time.Unix(4600, 0), Step: 5 * time.Minute,
+				})
+				return err
+			},
+			want: []string{
+				`cpu{ namespace="shop", pod=~"web-1|web\\.2", k8s="prod"}[300s] by container`,
+				`mem{ namespace="shop", pod=~"web-1|web\\.2" }`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.requests = nil
+			if err := tt.call(f.provider(t, tt.cfg)); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range f.requests {
+				got = append(got, r.Query)
+				if r.Authorization != tt.auth {
+					t.Errorf("Authorization = %q, want %q", r.Authorization, tt.auth)
+				}
+				for _, s := range tt.wantNo {
+					if strings.Contains(r.Query, s) {
+						t.Errorf("query %q contains %q", r.Query, s)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queries:\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrometheusRangeStepAndRate(t *testing.T) {
+	f := newFakePrometheus(t, func(string) (int, string) {
+		return 200, promMatrix(map[string][]float64{"app": {0.1}}, 1000, 30)
+	})
+	p := f.provider(t, PrometheusConfig{CPUQuery: `cpu[{{.Rate}}]`, MemoryQuery: `mem`})
+	cl := &Cluster{Name: "prod"}
+
+	tests := []struct {
+		step     time.Duration
+		wantStep string
+		wantRate string
+	}{
+		{30 * time.Second, "30s", "cpu[120s]"},
+		{1500 * time.Millisecond, "2s", "cpu[120s]"},
+		{2 * time.Minute, "120s", "cpu[120s]"},
+		{10 * time.Minute, "600s", "cpu[600s]"},
+	}
+	for _, tt := range tests {
+		f.requests = nil
+		_, err := p.UsageRange(context.Background(), cl, UsageQuery{
+			Kind: HistoryPod, Namespace: "shop", Name: "web-1",
+			Start: time.Unix(1000, 0), End: time.Unix(4600, 0), Step: tt.step,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.requests) != 2 {
+			t.Fatalf("step %s: %d requests, want 2", tt.step, len(f.requests))
+		}
+		cpu := f.requests[0]
+		if cpu.Path != "/api/v1/query_range" || cpu.Start != "1000" || cpu.End != "4600" {
+			t.Errorf("step %s: request %+v", tt.step, cpu)
+		}
+		if cpu.Step != tt.wantStep || cpu.Query != tt.wantRate {
+			t.Errorf("step %s: got step=%s query=%s, want step=%s query=%s", tt.step, cpu.Step, cpu.Query, tt.wantStep, tt.wantRate)
+		}
+	}
+}
+
+func TestPrometheusErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		body string
+		want string
+	}{
+		{"query error", 400, `{"status":"error","errorType":"bad_data","error":"parse error at char 5"}`, "bad_data"},
+		{"not json", 502, `<html>bad gateway</html>`, "502"},
+		{"server error", 503, `{"status":"error","errorType":"unavailable","error":"overloaded"}`, "overloaded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakePrometheus(t, func(string) (int, string) { return tt.code, tt.body })
+			p := f.provider(t, PrometheusConfig{})
+
+			_, err := p.PodMetrics(context.Background(), &Cluster{Name: "prod"}, "shop", "web-1")
+			if !apierrors.IsServiceUnavailable(err) {
+				t.Fatalf("err = %v, want a 503", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		f := newFakePrometheus(t, nil)
+		p := f.provider(t, PrometheusConfig{})
+		f.Close()
+		_, err := p.NodeMetrics(context.Background(), &Cluster{Name: "prod"}, "node-a")
+		if !apierrors.IsServiceUnavailable(err) {
+			t.Fatalf("err = %v, want a 503", err)
+		}
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		f := newFakePrometheus(t, func(string) (int, string) { return 200, promVector(nil) })
+		p := f.provider(t, PrometheusConfig{})
+		_, err := p.PodMetrics(context.Background(), &Cluster{Name: "prod"}, "shop", "gone")
+		if !apierrors.IsNotFound(err) {
+			t.Fatalf("err = %v, want NotFound", err)
+		}
+	})
+}
+
+func TestNewPrometheusProviderValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  PrometheusConfig
+	}{
+		{"no scheme", PrometheusConfig{URL: "prometheus:9090"}},
+		{"bad template", PrometheusConfig{URL: "http://p", CPUQuery: "{{.Selector"}},
+		{"bad cluster label", PrometheusConfig{URL: "http://p", ClusterLabel: "k8s-cluster"}},
+		{"bad node label", PrometheusConfig{URL: "http://p", NodeLabel: "kubernetes.io/hostname"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewPrometheusProvider(tt.cfg); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestMergeUsageSeries(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	t1 := time.Unix(1030, 0)
+	ts := func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+	series := func(container string, samples ...promSample) promSeries {
+		return promSeries{Metric: map[string]string{"container": container}, Values: samples}
+	}
+	nan := promSample{T: t1, V: math.NaN()}
+
+	cpu := []promSeries{
+		series("app", promSample{t0, 0.25}, promSample{t1, 0.5}),
+		series("sidecar", promSample{t0, 0.0104}, nan),
+	}
+	memory := []promSeries{
+		series("app", promSample{t0, 100}, promSample{t1, 200}),
+		series("sidecar", promSample{t1, 50}),
+	}
+
+	got := mergeUsageSeries(cpu, memory, true)
+	want := []MetricsSeries{
+		{Container: "", Points: []MetricsPoint{{Time: ts(t0), CPU: 260, Memory: 100}, {Time: ts(t1), CPU: 500, Memory: 250}}},
+		{Container: "app", Points: []MetricsPoint{{Time: ts(t0), CPU: 250, Memory: 100}, {Time: ts(t1), CPU: 500, Memory: 200}}},
+		{Container: "sidecar", Points: []MetricsPoint{{Time: ts(t0), CPU: 10}, {Time: ts(t1), Memory: 50}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeUsageSeries with total:\n got %+v\nwant %+v", got, want)
+	}
+
+	// Ungrouped (node) queries have a single unlabelled series and no total.
+	node := []promSeries{{Metric: map[string]string{}, Values: []promSample{{t0, 1.5}}}}
+	got = mergeUsageSeries(node, nil, false)
+	want = []MetricsSeries{{Container: "", Points: []MetricsPoint{{Time: ts(t0), CPU: 1500}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeUsageSeries without total:\n got %+v\nwant %+v", got, want)
+	}
+
+	if got := mergeUsageSeries(nil, nil, true); len(got) != 0 {
+		t.Errorf("mergeUsageSeries of nothing = %+v", got)
+	}
+}
+
+func TestPrometheusMetricsTables(t *testing.T) {
+	labeled := func(value float64, labels ...string) map[string]any {
+		metric := map[string]string{}
+		for i := 0; i < len(labels); i += 2 {
+			metric[labels[i]] = labels[i+1]
+		}
+		return map[string]any{"metric": metric, "value": []any{1700000000, jsonFloat(value)}}
+	}
+	f := newFakePrometheus(t, func(query string) (int, string) {
+		cpu := strings.Contains(query, "cpu")
+		switch {
+		case strings.Contains(query, "by (node)") && cpu:
+			return 200, promEnvelope("vector", []map[string]any{labeled(1.5, "node", "node-a")})
+		case strings.Contains(query, "by (node)"):
+			return 200, promEnvelope("vector", []map[string]any{labeled(2<<30, "node", "node-a")})
+		case cpu:
+			return 200, promEnvelope("vector", []map[string]any{
+				labeled(0.1, "namespace", "shop", "pod", "web-1", "container", "app"),
+				labeled(0.05, "namespace", "shop", "pod", "web-1", "container", "proxy"),
+				labeled(0.2, "namespace", "shop", "pod", "db-0", "container", "db"),
+			})
+		default:
+			return 200, promEnvelope("vector", []map[string]any{
+				labeled(64<<20, "namespace", "shop", "pod", "web-1", "container", "app"),
+				labeled(256<<20, "namespace", "shop", "pod", "db-0", "container", "db"),
+			})
+		}
+	})
+
+	cl := fakeCluster(nil)
+	cl.Name = "prom-tables"
+	SetMetricsProvider(cl.Name, f.provider(t, PrometheusConfig{}))
+	t.Cleanup(func() { delete(metricsProviders, cl.Name) })
+
+	pods, err := ListPodMetrics(context.Background(), cl, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 2 || pods[0].Name != "db-0" || pods[0].CPU != 200 || pods[0].Memory != 256<<20 {
+		t.Fatalf("pods = %+v", pods)
+	}
+	web := pods[1]
+	if web.CPU != 150 || web.Memory != 64<<20 || len(web.Containers) != 2 || web.Containers[1].Name != "proxy" || web.Containers[1].Memory != 0 {
+		t.Errorf("web-1 = %+v", web)
+	}
+
+	nodes, err := ListNodeMetrics(context.Background(), cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "node-a" || nodes[0].CPU != 1500 || nodes[0].Memory != 2<<30 {
+		t.Errorf("nodes = %+v", nodes)
+	}
+
+	for _, r := range f.requests {
+		if !strings.Contains(r.Query, `namespace="shop"`) && !strings.Contains(r.Query, `node!=""`) {
+			t.Errorf("unexpected query %q", r.Query)
+		}
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type ResourceRow struct {
@@ -18,9 +22,58 @@ type ResourceRow struct {
 	Labels            map[string]string `json:"labels"`
 }
 
-func ListResources(namespace, rtype string) ([]ResourceRow, error) {
-	cs := Clientset()
+// resourceGVRs maps the resource type keys used by the API to their
+// GroupVersionResource. It is the set of types ListResources supports.
+var resourceGVRs = map[string]schema.GroupVersionResource{
+	"nodes":        {Version: "v1", Resource: "nodes"},
+	"pods":         {Version: "v1", Resource: "pods"},
+	"services":     {Version: "v1", Resource: "services"},
+	"configmaps":   {Version: "v1", Resource: "configmaps"},
+	"secrets":      {Version: "v1", Resource: "secrets"},
+	"deployments":  {Group: "apps", Version: "v1", Resource: "deployments"},
+	"replicasets":  {Group: "apps", Version: "v1", Resource: "replicasets"},
+	"statefulsets": {Group: "apps", Version: "v1", Resource: "statefulsets"},
+	"daemonsets":   {Group: "apps", Version: "v1", Resource: "daemonsets"},
+	"jobs":         {Group: "batch", Version: "v1", Resource: "jobs"},
+	"cronjobs":     {Group: "batch", Version: "v1", Resource: "cronjobs"},
+}
+
+// ListResources serves rows for built-in types from the cluster's informer
+// cache once the informer for rtype has synced, and falls back to a direct
+// List until then. Any other discovered type (CRDs included) is listed through
+// the dynamic client.
+func ListResources(ctx context.Context, cl *Cluster, namespace, rtype string) ([]ResourceRow, error) {
 	rtype = strings.ToLower(rtype)
+	if _, ok := resourceGVRs[rtype]; !ok {
+		t, err := LookupResourceType(ctx, cl, rtype)
+		if err != nil {
+			return nil, err
+		}
+		return listDynamic(ctx, cl, namespace, t)
+	}
+
+	if objs, ok := cl.ResourceCache().List(rtype, namespace); ok {
+		out := make([]ResourceRow, 0, len(objs))
+		for _, obj := range objs {
+			if row, ok := RowFor(obj); ok {
+				out = append(out, row)
+			}
+		}
+		// Informer stores are unordered; match the API server's name ordering.
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Namespace != out[j].Namespace {
+				return out[i].Namespace < out[j].Namespace
+			}
+			return out[i].Name < out[j].Name
+		})
+		return out, nil
+	}
+
+	return listResourcesDirect(ctx, cl, namespace, rtype)
+}
+
+func listResourcesDirect(ctx context.Context, cl *Cluster, namespace, rtype string) ([]ResourceRow, error) {
+	cs := cl.Clientset
 
 	switch rtype {
 
@@ -28,127 +81,57 @@ func ListResources(namespace, rtype string) ([]ResourceRow, error) {
 	// Core resources
 	// -----------------------------
 	case "nodes":
-		list, err := cs.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		list, err := cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 		if err != nil {
 			return nil, err
 		}
 		out := make([]ResourceRow, 0, len(list.Items))
 		for i := range list.Items {
-			node := &list.Items[i]
-
-			// Determine node status
-			ready := "NotReady"
-			for _, cond := range node.Status.Conditions {
-				if cond.Type == v1.NodeReady {
-					if cond.Status == v1.ConditionTrue {
-						ready = "Ready"
-					}
-					break
-				}
-			}
-
-			// Get node roles
-			roles := "worker"
-			if _, ok := node.Labels["node-role.kubernetes.io/master"]; ok {
-				roles = "master"
-			} else if _, ok := node.Labels["node-role.kubernetes.io/control-plane"]; ok {
-				roles = "control-plane"
-			}
-
-			// Get node version
-			version := node.Status.NodeInfo.KubeletVersion
-
-			// Get node internal IP
-			nodeIP := ""
-			for _, addr := range node.Status.Addresses {
-				if addr.Type == v1.NodeInternalIP {
-					nodeIP = addr.Address
-					break
-				}
-			}
-
-			out = append(out, ResourceRow{
-				Name:              node.Name,
-				Namespace:         "",
-				CreationTimestamp: node.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-				Labels:            node.Labels,
-				Status: map[string]any{
-					"ready":   ready,
-					"role":    roles,
-					"version": version,
-					"ip":      nodeIP,
-					"os":      node.Status.NodeInfo.OSImage,
-				},
-			})
+			out = append(out, nodeRow(&list.Items[i]))
 		}
 		return out, nil
 
 	case "pods":
-		list, err := cs.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+		list, err := cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
 		if err != nil {
 			return nil, err
 		}
 		out := make([]ResourceRow, 0, len(list.Items))
 		for i := range list.Items {
-			pod := &list.Items[i]
-			ready, total := PodReadyCount(pod)
-			restarts := PodRestarts(pod)
-			reason := PodWaitingReason(pod)
-
-			out = append(out, ResourceRow{
-				Name:              pod.Name,
-				Namespace:         pod.Namespace,
-				CreationTimestamp: pod.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-				Labels:            pod.Labels,
-				Status: map[string]any{
-					"phase":    string(pod.Status.Phase),
-					"ready":    fmt.Sprintf("%d/%d", ready, total),
-					"restarts": restarts,
-					"nodeName": pod.Spec.NodeName,
-					"reason":   reason,
-				},
-			})
+			out = append(out, podRow(&list.Items[i]))
 		}
 		return out, nil
 
 	case "services":
-		list, err := cs.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+		list, err := cs.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
 		if err != nil {
 			return nil, err
 		}
 		out := make([]ResourceRow, 0, len(list.Items))
 		for i := range list.Items {
-			svc := &list.Items[i]
-			out = append(out, ResourceRow{
-				Name:              svc.Name,
-				Namespace:         svc.Namespace,
-				CreationTimestamp: svc.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-				Labels:            svc.Labels,
-				Status: map[string]any{
-					"type":      string(svc.Spec.Type),
-					"clusterIP": svc.Spec.ClusterIP,
-				},
-			})
+			out = append(out, serviceRow(&list.Items[i]))
 		}
 		return out, nil
 
 	case "configmaps":
-		list, err := cs.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+		list, err := cs.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		out := make([]ResourceRow, 0, len(list.Items))
+		for i := range list.Items {
+			out = append(out, configMapRow(&list.Items[i]))
+		}
+		return out, nil
+
+	case "secrets":
+		list, err := cs.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
 		if err != nil {
 			return nil, err
 		}
 		out := make([]ResourceRow, 0, len(list.Items))
 		for i := range list.Items {
-			cm := &list.Items[i]
-			out = append(out, ResourceRow{
-				Name:              cm.Name,
-				Namespace:         cm.Namespace,
-				CreationTimestamp: cm.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-				Labels:            cm.Labels,
-				Status: map[string]any{
-					"keys": len(cm.Data),
-				},
-			})
+			out = append(out, secretRow(&list.Items[i]))
 		}
 		return out, nil
 
@@ -156,35 +139,162 @@ func ListResources(namespace, rtype string) ([]ResourceRow, error) {
 	// Apps resources
 	// -----------------------------
 	case "deployments":
-		return listDeployments(namespace)
+		return listDeployments(ctx, cl, namespace)
 
 	case "replicasets":
-		return listReplicaSets(namespace)
+		return listReplicaSets(ctx, cl, namespace)
 
 	case "statefulsets":
-		return listStatefulSets(namespace)
+		return listStatefulSets(ctx, cl, namespace)
 
 	case "daemonsets":
-		return listDaemonSets(namespace)
+		return listDaemonSets(ctx, cl, namespace)
 
 	// -----------------------------
 	// Batch resources
 	// -----------------------------
 	case "jobs":
-		return listJobs(namespace)
+		return listJobs(ctx, cl, namespace)
 
 	case "cronjobs":
-		return listCronJobs(namespace)
+		return listCronJobs(ctx, cl, namespace)
 	}
 
 	return nil, errors.New("unsupported resource type: " + rtype)
 }
 
-// Used by logs stream
-func defaultLogOptions() *v1.PodLogOptions {
-	tail := int64(50)
-	return &v1.PodLogOptions{
-		Follow:    true,
-		TailLines: &tail,
+// RowFor converts any supported typed object into its table row. Both the
+// direct List path and the informer cache go through the same converters.
+func RowFor(obj any) (ResourceRow, bool) {
+	switch o := obj.(type) {
+	case *v1.Node:
+		return nodeRow(o), true
+	case *v1.Pod:
+		return podRow(o), true
+	case *v1.Service:
+		return serviceRow(o), true
+	case *v1.ConfigMap:
+		return configMapRow(o), true
+	case *v1.Secret:
+		return secretRow(o), true
+	case *appsv1.Deployment:
+		return deploymentRow(o), true
+	case *appsv1.ReplicaSet:
+		return replicaSetRow(o), true
+	case *appsv1.StatefulSet:
+		return statefulSetRow(o), true
+	case *appsv1.DaemonSet:
+		return daemonSetRow(o), true
+	case *batchv1.Job:
+		return jobRow(o), true
+	case *batchv1.CronJob:
+		return cronJobRow(o), true
+	}
+	return ResourceRow{}, false
+}
+
+func nodeRow(node *v1.Node) ResourceRow {
+	// Determine node status
+	ready := "NotReady"
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady {
+			if cond.Status == v1.ConditionTrue {
+				ready = "Ready"
+			}
+			break
+		}
+	}
+
+	// Get node roles
+	roles := "worker"
+	if _, ok := node.Labels["node-role.kubernetes.io/master"]; ok {
+		roles = "master"
+	} else if _, ok := node.Labels["node-role.kubernetes.io/control-plane"]; ok {
+		roles = "control-plane"
+	}
+
+	// Get node version
+	version := node.Status.NodeInfo.KubeletVersion
+
+	// Get node internal IP
+	nodeIP := ""
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			nodeIP = addr.Address
+			break
+		}
+	}
+
+	return ResourceRow{
+		Name:              node.Name,
+		Namespace:         "",
+		CreationTimestamp: node.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            node.Labels,
+		Status: map[string]any{
+			"ready":   ready,
+			"role":    roles,
+			"version": version,
+			"ip":      nodeIP,
+			"os":      node.Status.NodeInfo.OSImage,
+		},
+	}
+}
+
+func podRow(pod *v1.Pod) ResourceRow {
+	ready, total := PodReadyCount(pod)
+	restarts := PodRestarts(pod)
+	reason := PodWaitingReason(pod)
+
+	return ResourceRow{
+		Name:              pod.Name,
+		Namespace:         pod.Namespace,
+		CreationTimestamp: pod.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            pod.Labels,
+		Status: map[string]any{
+			"phase":    string(pod.Status.Phase),
+			"ready":    fmt.Sprintf("%d/%d", ready, total),
+			"restarts": restarts,
+			"nodeName": pod.Spec.NodeName,
+			"reason":   reason,
+		},
+	}
+}
+
+func serviceRow(svc *v1.Service) ResourceRow {
+	return ResourceRow{
+		Name:              svc.Name,
+		Namespace:         svc.Namespace,
+		CreationTimestamp: svc.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            svc.Labels,
+		Status: map[string]any{
+			"type":      string(svc.Spec.Type),
+			"clusterIP": svc.Spec.ClusterIP,
+		},
+	}
+}
+
+func configMapRow(cm *v1.ConfigMap) ResourceRow {
+	return ResourceRow{
+		Name:              cm.Name,
+		Namespace:         cm.Namespace,
+		CreationTimestamp: cm.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            cm.Labels,
+		Status: map[string]any{
+			"keys": len(cm.Data),
+		},
+	}
+}
+
+// secretRow never carries secret values, only the type and key count.
+func secretRow(sec *v1.Secret) ResourceRow {
+	return ResourceRow{
+		Name:              sec.Name,
+		Namespace:         sec.Namespace,
+		CreationTimestamp: sec.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            sec.Labels,
+		Status: map[string]any{
+			"type": string(sec.Type),
+			"keys": len(sec.Data),
+		},
 	}
 }
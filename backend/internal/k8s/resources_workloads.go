@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -11,209 +13,221 @@ import (
 // Apps Workloads
 // -----------------------------
 
-func listDeployments(namespace string) ([]ResourceRow, error) {
-	cs := Clientset()
+func listDeployments(ctx context.Context, cl *Cluster, namespace string) ([]ResourceRow, error) {
+	cs := cl.Clientset
 
-	list, err := cs.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
+	list, err := cs.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	out := make([]ResourceRow, 0, len(list.Items))
 	for i := range list.Items {
-		d := &list.Items[i]
-
-		ready := int32(0)
-		if d.Status.ReadyReplicas > 0 {
-			ready = d.Status.ReadyReplicas
-		}
-
-		replicas := int32(0)
-		if d.Spec.Replicas != nil {
-			replicas = *d.Spec.Replicas
-		}
-
-		out = append(out, ResourceRow{
-			Name:              d.Name,
-			Namespace:         d.Namespace,
-			CreationTimestamp: d.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-			Labels:            d.Labels,
-			Status: map[string]any{
-				"readyReplicas": ready,
-				"replicas":      replicas,
-				"updated":       d.Status.UpdatedReplicas,
-				"available":     d.Status.AvailableReplicas,
-			},
-		})
+		out = append(out, deploymentRow(&list.Items[i]))
 	}
 	return out, nil
 }
 
-func listReplicaSets(namespace string) ([]ResourceRow, error) {
-	cs := Clientset()
+func deploymentRow(d *appsv1.Deployment) ResourceRow {
+	ready := int32(0)
+	if d.Status.ReadyReplicas > 0 {
+		ready = d.Status.ReadyReplicas
+	}
+
+	replicas := int32(0)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+
+	return ResourceRow{
+		Name:              d.Name,
+		Namespace:         d.Namespace,
+		CreationTimestamp: d.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            d.Labels,
+		Status: map[string]any{
+			"readyReplicas": ready,
+			"replicas":      replicas,
+			"updated":       d.Status.UpdatedReplicas,
+			"available":     d.Status.AvailableReplicas,
+		},
+	}
+}
 
-	list, err := cs.AppsV1().ReplicaSets(namespace).List(context.TODO(), metav1.ListOptions{})
+func listReplicaSets(ctx context.Context, cl *Cluster, namespace string) ([]ResourceRow, error) {
+	cs := cl.Clientset
+
+	list, err := cs.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	out := make([]ResourceRow, 0, len(list.Items))
 	for i := range list.Items {
-		rs := &list.Items[i]
-
-		replicas := int32(0)
-		if rs.Spec.Replicas != nil {
-			replicas = *rs.Spec.Replicas
-		}
-
-		out = append(out, ResourceRow{
-			Name:              rs.Name,
-			Namespace:         rs.Namespace,
-			CreationTimestamp: rs.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-			Labels:            rs.Labels,
-			Status: map[string]any{
-				"readyReplicas": rs.Status.ReadyReplicas,
-				"replicas":      replicas,
-				"available":     rs.Status.AvailableReplicas,
-			},
-		})
+		out = append(out, replicaSetRow(&list.Items[i]))
 	}
 	return out, nil
 }
 
-func listStatefulSets(namespace string) ([]ResourceRow, error) {
-	cs := Clientset()
+func replicaSetRow(rs *appsv1.ReplicaSet) ResourceRow {
+	replicas := int32(0)
+	if rs.Spec.Replicas != nil {
+		replicas = *rs.Spec.Replicas
+	}
+
+	return ResourceRow{
+		Name:              rs.Name,
+		Namespace:         rs.Namespace,
+		CreationTimestamp: rs.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            rs.Labels,
+		Status: map[string]any{
+			"readyReplicas": rs.Status.ReadyReplicas,
+			"replicas":      replicas,
+			"available":     rs.Status.AvailableReplicas,
+		},
+	}
+}
+
+func listStatefulSets(ctx context.Context, cl *Cluster, namespace string) ([]ResourceRow, error) {
+	cs := cl.Clientset
 
-	list, err := cs.AppsV1().StatefulSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	list, err := cs.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	out := make([]ResourceRow, 0, len(list.Items))
 	for i := range list.Items {
-		sts := &list.Items[i]
-
-		replicas := int32(0)
-		if sts.Spec.Replicas != nil {
-			replicas = *sts.Spec.Replicas
-		}
-
-		out = append(out, ResourceRow{
-			Name:              sts.Name,
-			Namespace:         sts.Namespace,
-			CreationTimestamp: sts.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-			Labels:            sts.Labels,
-			Status: map[string]any{
-				"readyReplicas": sts.Status.ReadyReplicas,
-				"replicas":      replicas,
-				"updated":       sts.Status.UpdatedReplicas,
-				"current":       sts.Status.CurrentReplicas,
-			},
-		})
+		out = append(out, statefulSetRow(&list.Items[i]))
 	}
 	return out, nil
 }
 
-func listDaemonSets(namespace string) ([]ResourceRow, error) {
-	cs := Clientset()
+func statefulSetRow(sts *appsv1.StatefulSet) ResourceRow {
+	replicas := int32(0)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+
+	return ResourceRow{
+		Name:              sts.Name,
+		Namespace:         sts.Namespace,
+		CreationTimestamp: sts.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            sts.Labels,
+		Status: map[string]any{
+			"readyReplicas": sts.Status.ReadyReplicas,
+			"replicas":      replicas,
+			"updated":       sts.Status.UpdatedReplicas,
+			"current":       sts.Status.CurrentReplicas,
+		},
+	}
+}
+
+func listDaemonSets(ctx context.Context, cl *Cluster, namespace string) ([]ResourceRow, error) {
+	cs := cl.Clientset
 
-	list, err := cs.AppsV1().DaemonSets(namespace).List(context.TODO(), metav1.ListOptions{})
+	list, err := cs.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	out := make([]ResourceRow, 0, len(list.Items))
 	for i := range list.Items {
-		ds := &list.Items[i]
-
-		out = append(out, ResourceRow{
-			Name:              ds.Name,
-			Namespace:         ds.Namespace,
-			CreationTimestamp: ds.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-			Labels:            ds.Labels,
-			Status: map[string]any{
-				"readyReplicas": ds.Status.NumberReady,
-				"replicas":      ds.Status.DesiredNumberScheduled,
-				"current":       ds.Status.CurrentNumberScheduled,
-				"available":     ds.Status.NumberAvailable,
-			},
-		})
+		out = append(out, daemonSetRow(&list.Items[i]))
 	}
 	return out, nil
 }
 
+func daemonSetRow(ds *appsv1.DaemonSet) ResourceRow {
+	return ResourceRow{
+		Name:              ds.Name,
+		Namespace:         ds.Namespace,
+		CreationTimestamp: ds.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            ds.Labels,
+		Status: map[string]any{
+			"readyReplicas": ds.Status.NumberReady,
+			"replicas":      ds.Status.DesiredNumberScheduled,
+			"current":       ds.Status.CurrentNumberScheduled,
+			"available":     ds.Status.NumberAvailable,
+		},
+	}
+}
+
 // -----------------------------
 // Batch Workloads
 // -----------------------------
 
-func listJobs(namespace string) ([]ResourceRow, error) {
-	cs := Clientset()
+func listJobs(ctx context.Context, cl *Cluster, namespace string) ([]ResourceRow, error) {
+	cs := cl.Clientset
 
-	list, err := cs.BatchV1().Jobs(namespace).List(context.TODO(), metav1.ListOptions{})
+	list, err := cs.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	out := make([]ResourceRow, 0, len(list.Items))
 	for i := range list.Items {
-		j := &list.Items[i]
-
-		desired := int32(1)
-		if j.Spec.Parallelism != nil {
-			desired = *j.Spec.Parallelism
-		}
-
-		completions := int32(0)
-		if j.Spec.Completions != nil {
-			completions = *j.Spec.Completions
-		}
-
-		out = append(out, ResourceRow{
-			Name:              j.Name,
-			Namespace:         j.Namespace,
-			CreationTimestamp: j.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-			Labels:            j.Labels,
-			Status: map[string]any{
-				"active":      j.Status.Active,
-				"succeeded":   j.Status.Succeeded,
-				"failed":      j.Status.Failed,
-				"parallelism": desired,
-				"completions": completions,
-			},
-		})
+		out = append(out, jobRow(&list.Items[i]))
 	}
 	return out, nil
 }
 
-func listCronJobs(namespace string) ([]ResourceRow, error) {
-	cs := Clientset()
+func jobRow(j *batchv1.Job) ResourceRow {
+	desired := int32(1)
+	if j.Spec.Parallelism != nil {
+		desired = *j.Spec.Parallelism
+	}
+
+	completions := int32(0)
+	if j.Spec.Completions != nil {
+		completions = *j.Spec.Completions
+	}
+
+	return ResourceRow{
+		Name:              j.Name,
+		Namespace:         j.Namespace,
+		CreationTimestamp: j.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            j.Labels,
+		Status: map[string]any{
+			"active":      j.Status.Active,
+			"succeeded":   j.Status.Succeeded,
+			"failed":      j.Status.Failed,
+			"parallelism": desired,
+			"completions": completions,
+		},
+	}
+}
+
+func listCronJobs(ctx context.Context, cl *Cluster, namespace string) ([]ResourceRow, error) {
+	cs := cl.Clientset
 
-	list, err := cs.BatchV1().CronJobs(namespace).List(context.TODO(), metav1.ListOptions{})
+	list, err := cs.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	out := make([]ResourceRow, 0, len(list.Items))
 	for i := range list.Items {
-		cj := &list.Items[i]
-
-		lastSchedule := ""
-		if cj.Status.LastScheduleTime != nil {
-			lastSchedule = cj.Status.LastScheduleTime.Time.Format("2006-01-02T15:04:05Z")
-		}
-
-		out = append(out, ResourceRow{
-			Name:              cj.Name,
-			Namespace:         cj.Namespace,
-			CreationTimestamp: cj.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
-			Labels:            cj.Labels,
-			Status: map[string]any{
-				"schedule":       cj.Spec.Schedule,
-				"suspend":        fmt.Sprintf("%v", cj.Spec.Suspend != nil && *cj.Spec.Suspend),
-				"activeJobs":     len(cj.Status.Active),
-				"lastScheduleAt": lastSchedule,
-			},
-		})
+		out = append(out, cronJobRow(&list.Items[i]))
 	}
 	return out, nil
 }
+
+func cronJobRow(cj *batchv1.CronJob) ResourceRow {
+	lastSchedule := ""
+	if cj.Status.LastScheduleTime != nil {
+		lastSchedule = cj.Status.LastScheduleTime.Time.Format("2006-01-02T15:04:05Z")
+	}
+
+	return ResourceRow{
+		Name:              cj.Name,
+		Namespace:         cj.Namespace,
+		CreationTimestamp: cj.CreationTimestamp.Time.Format("2006-01-02T15:04:05Z"),
+		Labels:            cj.Labels,
+		Status: map[string]any{
+			"schedule":       cj.Spec.Schedule,
+			"suspend":        fmt.Sprintf("%v", cj.Spec.Suspend != nil && *cj.Spec.Suspend),
+			"activeJobs":     len(cj.Status.Active),
+			"lastScheduleAt": lastSchedule,
+		},
+	}
+}
@@ -0,0 +1,233 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// Resource watch event types. Snapshot carries the full table; the others
+// mirror the Kubernetes watch event types.
+const (
+	EventSnapshot = "SNAPSHOT"
+	EventAdded    = "ADDED"
+	EventModified = "MODIFIED"
+	EventDeleted  = "DELETED"
+	EventBookmark = "BOOKMARK"
+	EventError    = "ERROR"
+)
+
+// ResourceEvent is one message of a resource watch stream. ResourceVersion is
+// the version a client can resume from after this event.
+type ResourceEvent struct {
+	Type            string        `json:"type"`
+	ResourceVersion string        `json:"resourceVersion"`
+	Row             *ResourceRow  `json:"row,omitempty"`
+	Rows            []ResourceRow `json:"rows,omitempty"`
+
+	// Err is set on EventError, the last event before the channel closes.
+	Err error `json:"-"`
+}
+
+// WatchResources streams table rows of rtype in namespace. Unless
+// resumeVersion is set it starts with a snapshot of the current rows, then
+// follows a Kubernetes watch, re-listing whenever the watched version has
+// expired. Built-in types are watched through their typed clients; any other
+// discovered type (CRDs included) through the dynamic client. The channel is
+// closed when ctx is cancelled or the watch fails.
+func WatchResources(ctx context.Context, cl *Cluster, namespace, rtype, resumeVersion string) (<-chan ResourceEvent, error) {
+	rtype = strings.ToLower(rtype)
+	w := &resourceWatcher{out: make(chan ResourceEvent)}
+
+	if gvr, ok := resourceGVRs[rtype]; ok {
+		rc, err := restClientFor(cl, gvr)
+		if err != nil {
+			return nil, err
+		}
+		if rtype == "nodes" {
+			namespace = ""
+		}
+		w.list = func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return rc.Get().
+				Namespace(namespace).
+				Resource(gvr.Resource).
+				VersionedParams(&opts, scheme.ParameterCodec).
+				Do(ctx).
+				Get()
+		}
+		w.watch = func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return rc.Get().
+				Namespace(namespace).
+				Resource(gvr.Resource).
+				VersionedParams(&opts, scheme.ParameterCodec).
+				Watch(ctx)
+		}
+		w.row = RowFor
+	} else {
+		t, err := LookupResourceType(ctx, cl, rtype)
+		if err != nil {
+			return nil, err
+		}
+		nri := cl.Dynamic.Resource(t.GVR())
+		var ri dynamic.ResourceInterface = nri
+		if t.Namespaced && namespace != "" {
+			ri = nri.Namespace(namespace)
+		}
+		w.list = func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return ri.List(ctx, opts)
+		}
+		w.watch = ri.Watch
+		w.row = func(obj any) (ResourceRow, bool) {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				return ResourceRow{}, false
+			}
+			return unstructuredRow(u, t.Columns), true
+		}
+	}
+
+	go w.run(ctx, resumeVersion)
+	return w.out, nil
+}
+
+// restClientFor returns the typed REST client serving gvr's API group.
+func restClientFor(cl *Cluster, gvr schema.GroupVersionResource) (rest.Interface, error) {
+	cs := cl.Clientset
+	switch gvr.Group {
+	case "":
+		return cs.CoreV1().RESTClient(), nil
+	case "apps":
+		return cs.AppsV1().RESTClient(), nil
+	case "batch":
+		return cs.BatchV1().RESTClient(), nil
+	}
+	return nil, fmt.Errorf("no client for API group %q", gvr.Group)
+}
+
+// resourceWatcher lists and watches one type in one namespace (or all).
+type resourceWatcher struct {
+	list  func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error)
+	watch func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	row   func(obj any) (ResourceRow, bool)
+	out   chan ResourceEvent
+}
+
+func (w *resourceWatcher) run(ctx context.Context, rv string) {
+	defer close(w.out)
+
+	for ctx.Err() == nil {
+		if rv == "" {
+			ev, err := w.snapshot(ctx)
+			if err != nil {
+				w.send(ctx, ResourceEvent{Type: EventError, Err: err})
+				return
+			}
+			if !w.send(ctx, ev) {
+				return
+			}
+			rv = ev.ResourceVersion
+		}
+
+		next, err := w.follow(ctx, rv)
+		if err != nil {
+			w.send(ctx, ResourceEvent{Type: EventError, ResourceVersion: rv, Err: err})
+			return
+		}
+		rv = next
+	}
+}
+
+func (w *resourceWatcher) snapshot(ctx context.Context) (ResourceEvent, error) {
+	obj, err := w.list(ctx, metav1.ListOptions{})
+	if err != nil {
+		return ResourceEvent{}, err
+	}
+
+	listMeta, err := meta.ListAccessor(obj)
+	if err != nil {
+		return ResourceEvent{}, err
+	}
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return ResourceEvent{}, err
+	}
+
+	rows := make([]ResourceRow, 0, len(items))
+	for _, item := range items {
+		if row, ok := w.row(item); ok {
+			rows = append(rows, row)
+		}
+	}
+	return ResourceEvent{Type: EventSnapshot, ResourceVersion: listMeta.GetResourceVersion(), Rows: rows}, nil
+}
+
+// follow watches from rv until the server closes the watch, returning the
+// version to resume from. An empty version means the caller must re-list
+// because rv is too old.
+func (w *resourceWatcher) follow(ctx context.Context, rv string) (string, error) {
+	watcher, err := w.watch(ctx, metav1.ListOptions{ResourceVersion: rv, AllowWatchBookmarks: true})
+	if err != nil {
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			return "", nil
+		}
+		return rv, err
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return rv, nil
+		case ev, ok := <-watcher.ResultChan():
+			if !ok {
+				return rv, nil
+			}
+
+			if ev.Type == watch.Error {
+				err := apierrors.FromObject(ev.Object)
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					return "", nil
+				}
+				return rv, err
+			}
+
+			acc, err := meta.Accessor(ev.Object)
+			if err != nil {
+				continue
+			}
+			rv = acc.GetResourceVersion()
+
+			out := ResourceEvent{Type: string(ev.Type), ResourceVersion: rv}
+			if ev.Type != watch.Bookmark {
+				row, ok := w.row(ev.Object)
+				if !ok {
+					continue
+				}
+				out.Row = &row
+			}
+			if !w.send(ctx, out) {
+				return rv, nil
+			}
+		}
+	}
+}
+
+func (w *resourceWatcher) send(ctx context.Context, ev ResourceEvent) bool {
+	select {
+	case w.out <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
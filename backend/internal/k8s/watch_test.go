@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func widget(name, size string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]any{"name": name, "namespace": "shop"},
+		"spec":       map[string]any{"size": size},
+	}}
+}
+
+func TestWatchResourcesDynamic(t *testing.T) {
+	widgets := APIResourceType{
+		Key: "widgets.example.com", Group: "example.com", Version: "v1", Resource: "widgets", Kind: "Widget", Namespaced: true,
+		Columns: []PrinterColumn{{Name: "Size", Key: "column.size", JSONPath: ".spec.size"}},
+	}
+	cl := fakeCluster([]APIResourceType{widgets}, widget("a", "small"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := WatchResources(ctx, cl, "shop", "widgets.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap := <-events
+	if snap.Type != EventSnapshot || len(snap.Rows) != 1 {
+		t.Fatalf("first event = %+v, want a one-row snapshot", snap)
+	}
+	if row := snap.Rows[0]; row.Name != "a" || row.Status["column.size"] != "small" || row.Status["kind"] != "Widget" {
+		t.Errorf("snapshot row = %+v", row)
+	}
+
+	_, err = cl.Dynamic.Resource(widgets.GVR()).Namespace("shop").Create(ctx, widget("b", "large"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventAdded || ev.Row == nil || ev.Row.Name != "b" || ev.Row.Status["column.size"] != "large" {
+			t.Errorf("watch event = %+v, want ADDED b", ev)
+		}
+	case <-ctx.Done():
+		t.Fatal("no watch event")
+	}
+}
+
+func TestWatchResourcesUnknownType(t *testing.T) {
+	cl := fakeCluster(coreTypes)
+	_, err := WatchResources(context.Background(), cl, "shop", "gadgets.example.com", "")
+	if !apierrors.IsBadRequest(err) {
+		t.Errorf("err = %v, want BadRequest", err)
+	}
+}
+
+func TestRequiresNamespace(t *testing.T) {
+	cl := fakeCluster([]APIResourceType{
+		{Key: "storageclasses.storage.k8s.io", Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"},
+		{Key: "widgets.example.com", Group: "example.com", Version: "v1", Resource: "widgets", Namespaced: true},
+	})
+	tests := map[string]bool{
+		"pods":                          true,
+		"nodes":                         false,
+		"storageclasses.storage.k8s.io": false,
+		"widgets.example.com":           true,
+	}
+	for rtype, want := range tests {
+		if got := RequiresNamespace(context.Background(), cl, rtype); got != want {
+			t.Errorf("RequiresNamespace(%s) = %v, want %v", rtype, got, want)
+		}
+	}
+}
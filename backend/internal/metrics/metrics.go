@@ -0,0 +1,274 @@
+// Package metrics exposes webk8s's own Prometheus metrics: HTTP requests per
+// route, Kubernetes API client requests, SSE streams and cache sizes.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "webk8s"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route. SSE streams are excluded.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	sseStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sse_streams_active",
+		Help:      "Server-sent event streams (log follows, watches, drains) currently open, by route.",
+	}, []string{"route"})
+
+	sseBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sse_bytes_total",
+		Help:      "Bytes written to server-sent event streams, by route.",
+	}, []string{"route"})
+
+	kubeRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kube_client_requests_total",
+		Help:      "Kubernetes API requests, by cluster, verb, resource and status code (\"error\" when no response was received).",
+	}, []string{"cluster", "verb", "resource", "code"})
+
+	kubeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "kube_client_request_duration_seconds",
+		Help:      "Kubernetes API request latency until response headers, by cluster, verb and resource.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"cluster", "verb", "resource"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, sseStreams, sseBytes,
+		kubeRequests, kubeDuration,
+		cacheCollector{},
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records request counts and latency per registered route (the
+// route pattern, not the raw path, to keep label cardinality bounded), and
+// tracks open SSE streams and the bytes written to them.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		start := time.Now()
+		w := &responseWriter{ResponseWriter: c.Writer, route: route}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.stream {
+			sseStreams.WithLabelValues(route).Dec()
+		} else {
+			httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(w.Status())).Inc()
+	}
+}
+
+// responseWriter notices when a handler starts an event stream: SSE handlers
+// set the content type and flush the headers before the first event.
+type responseWriter struct {
+	gin.ResponseWriter
+	route   string
+	checked bool
+	stream  bool
+}
+
+func (w *responseWriter) detect() {
+	if w.checked {
+		return
+	}
+	w.checked = true
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stream = true
+		sseStreams.WithLabelValues(w.route).Inc()
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.detect()
+	n, err := w.ResponseWriter.Write(b)
+	if w.stream {
+		sseBytes.WithLabelValues(w.route).Add(float64(n))
+	}
+	return n, err
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.detect()
+	n, err := w.ResponseWriter.WriteString(s)
+	if w.stream {
+		sseBytes.WithLabelValues(w.route).Add(float64(n))
+	}
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	w.detect()
+	w.ResponseWriter.Flush()
+}
+
+// WrapTransport returns a client-go transport wrapper (for rest.Config.Wrap)
+// that records every Kubernetes API request of the named cluster.
+func WrapTransport(cluster string) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &roundTripper{cluster: cluster, next: rt}
+	}
+}
+
+type roundTripper struct {
+	cluster string
+	next    http.RoundTripper
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	verb, resource := requestInfo(req)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	kubeDuration.WithLabelValues(t.cluster, verb, resource).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	kubeRequests.WithLabelValues(t.cluster, verb, resource, code).Inc()
+	return resp, err
+}
+
+// requestInfo derives the kubectl-style verb (get, list, watch, create, ...)
+// and resource ("pods", "pods/log", "deployments.apps") of an API request.
+func requestInfo(req *http.Request) (verb, resource string) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	var group string
+	var rest []string
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		rest = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		group, rest = parts[1], parts[3:]
+	case parts[0] == "api" || parts[0] == "apis":
+	default:
+		return strings.ToLower(req.Method), "other"
+	}
+	if len(rest) == 0 {
+		return strings.ToLower(req.Method), "discovery"
+	}
+	if rest[0] == "namespaces" && len(rest) >= 3 {
+		rest = rest[2:]
+	}
+
+	resource = rest[0]
+	if group != "" {
+		resource += "." + group
+	}
+	if len(rest) >= 3 {
+		resource += "/" + rest[2]
+	}
+
+	named := len(rest) >= 2
+	switch req.Method {
+	case http.MethodGet:
+		switch {
+		case req.URL.Query().Get("watch") == "true" || req.URL.Query().Get("watch") == "1":
+			verb = "watch"
+		case named:
+			verb = "get"
+		default:
+			verb = "list"
+		}
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodPut:
+		verb = "update"
+	case http.MethodPatch:
+		verb = "patch"
+	case http.MethodDelete:
+		if named {
+			verb = "delete"
+		} else {
+			verb = "deletecollection"
+		}
+	default:
+		verb = strings.ToLower(req.Method)
+	}
+	return verb, resource
+}
+
+// CacheSize is the number of items one cache holds.
+type CacheSize struct {
+	Cluster string
+	Cache   string
+	Type    string
+	Items   int
+}
+
+var (
+	cacheMu    sync.Mutex
+	cacheSizes func() []CacheSize
+)
+
+// SetCacheSizes registers the function reporting cache sizes at scrape time.
+func SetCacheSizes(fn func() []CacheSize) {
+	cacheMu.Lock()
+	cacheSizes = fn
+	cacheMu.Unlock()
+}
+
+var cacheItemsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "cache_items"),
+	"Items held by in-memory caches, by cluster, cache and type.",
+	[]string{"cluster", "cache", "type"}, nil,
+)
+
+// cacheCollector reads the cache sizes on every scrape rather than keeping
+// a gauge up to date from the caches themselves.
+type cacheCollector struct{}
+
+func (cacheCollector) Describe(ch chan<- *prometheus.Desc) { ch <- cacheItemsDesc }
+
+func (cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	cacheMu.Lock()
+	fn := cacheSizes
+	cacheMu.Unlock()
+	if fn == nil {
+		return
+	}
+	for _, s := range fn() {
+		ch <- prometheus.MustNewConstMetric(cacheItemsDesc, prometheus.GaugeValue, float64(s.Items), s.Cluster, s.Cache, s.Type)
+	}
+}
@@ -5,7 +5,9 @@ async function apiGet(path) {
     const res = await fetch(path);
     if (!res.ok) {
       const text = await res.text();
-      throw new Error(`HTTP ${res.status}: ${text}`);
+      let msg = text;
+      try { msg = JSON.parse(text).message || text; } catch (_) {}
+      throw new Error(`HTTP ${res.status}: ${msg}`);
     }
     const data = await res.json();
     console.log("API response:", data);
@@ -119,7 +121,7 @@ async function init() {
 }
 
 function buildResourceTabs() {
-  const order = ["pods","nodes","deployments","replicasets","statefulsets","daemonsets","jobs","cronjobs","configmaps","services"];
+  const order = ["pods","nodes","deployments","replicasets","statefulsets","daemonsets","jobs","cronjobs","configmaps","secrets","services"];
   const typesByKey = {};
   state.resourceTypes.forEach(t => typesByKey[t.key] = t.label);
 